@@ -11,6 +11,12 @@ type Contact interface {
 	GetName() string
 }
 
+// Notifier is implemented by a Contact that can also be sent notices about dpoller itself rather than a check, such as
+// a cluster without a Coordinator. It's optional, so contacts that don't implement it are skipped by Notify.
+type Notifier interface {
+	SendNotice(subject, body string) error
+}
+
 var contacts []Contact
 
 type contactParseFunction func(message json.RawMessage) (contact Contact, err error)
@@ -1,14 +1,23 @@
 package alert
 
 import (
+	"fmt"
+	"github.com/alowde/dpoller/heartbeat"
 	"github.com/alowde/dpoller/url/check"
 	"time"
 )
 
 var notBefore = make(map[string]time.Time)
 
-// Send requests an alert for any configured contacts, passing on check & result information
+// Send requests an alert for any configured contacts, passing on check & result information. Nothing is sent unless
+// this node holds a current Coordinator lease, and the lease epoch is attached to the result so that receivers can
+// discard alerts from a Coordinator that has since been replaced.
 func Send(c check.Check, r check.Result) {
+	if !heartbeat.HoldsLease() {
+		log.WithField("check name", c.Name).Warn("Not sending alert without a current Coordinator lease")
+		return
+	}
+	r.Epoch = heartbeat.GetEpoch()
 	// don't send alerts more often than check.Check.AlertInterval
 	if nb, exist := notBefore[c.Name]; !exist || nb.Before(time.Now()) {
 		notBefore[c.Name] = time.Now().Add(time.Duration(c.AlertInterval) * time.Second)
@@ -23,3 +32,40 @@ func Send(c check.Check, r check.Result) {
 		}
 	}
 }
+
+// SendNoReports tells a check's contacts that no node has reported on it for a number of consensus windows. Like Send
+// it needs a current Coordinator lease and is limited by the check's alert interval.
+func SendNoReports(c check.Check, windows int) {
+	if !heartbeat.HoldsLease() {
+		return
+	}
+	key := c.Name + "\x00no-reports" // kept apart from the check's own alerts
+	if nb, exist := notBefore[key]; exist && nb.After(time.Now()) {
+		return
+	}
+	notBefore[key] = time.Now().Add(time.Duration(c.AlertInterval) * time.Second)
+	Notify(c.Contacts, fmt.Sprintf("no reports for %v", c.Name), fmt.Sprintf(
+		"No node has reported a result for %v (%v) in the last %v consensus windows, so it isn't being monitored. "+
+			"Check that the nodes running it are healthy. Coordinator lease epoch %v.",
+		c.Name, c.URL, windows, heartbeat.GetEpoch()))
+}
+
+// Notify sends a notice about the health of the dpoller cluster itself to the named contacts that are Notifiers. Unlike
+// Send it doesn't need a Coordinator lease, as the problem being reported may be that there's no Coordinator at all.
+func Notify(names []string, subject, body string) {
+	for _, name := range names {
+		for _, contact := range contacts {
+			if name != contact.GetName() {
+				continue
+			}
+			n, ok := contact.(Notifier)
+			if !ok {
+				log.WithField("contact", name).Warn("Contact can't be sent notices, skipping")
+				continue
+			}
+			if err := n.SendNotice(subject, body); err != nil {
+				log.WithField("error", err).Warn("Couldn't send notice message")
+			}
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/alowde/dpoller/logger"
 	"github.com/alowde/dpoller/url/check"
 	"net/smtp"
+	"sort"
 )
 
 // Config describes an SMTP relay host, used for sending alerts.
@@ -27,24 +28,51 @@ type smtpContact struct {
 	Email string `json:"email"`
 }
 
-// SendAlert satisfies half of the alert.Contact interface and allows this contact to be alerted.
+// SendAlert satisfies part of the alert.Contact interface and allows this contact to be alerted.
 func (c smtpContact) SendAlert(check check.Check, result check.Result) error {
 	smsg := fmt.Sprintf("To: %v\r\n"+
+		"X-Dpoller-Epoch: %v\r\n"+
 		"Subject: Alert from dpoller: %v failed %v of %v checks\r\n\r\n"+
 		"Dpoller reports that %v of %v checks failed when testing %v at %v\r\n"+
 		"IP Addresses reporting fail: %v",
-		c.Email, check.Name, result.Failed, result.Total,
+		c.Email, result.Epoch, check.Name, result.Failed, result.Total,
 		result.Failed, result.Total, check.Name, check.URL,
 		result.FailNodeIPs)
-	to := []string{c.Email}
-	msg := []byte(smsg)
+	if result.By != "" {
+		smsg += fmt.Sprintf("\r\n\r\nResults by %v:", result.By)
+		groups := make([]string, 0, len(result.Breakdown))
+		for g := range result.Breakdown {
+			groups = append(groups, g)
+		}
+		sort.Strings(groups)
+		for _, g := range groups {
+			gr := result.Breakdown[g]
+			smsg += fmt.Sprintf("\r\n%v: %v of %v checks failed (%v%% passed)", g, gr.Failed, gr.Total, gr.PassPercent)
+		}
+	}
+	if len(result.LowTrustNodes) > 0 {
+		smsg += fmt.Sprintf("\r\n\r\nNodes reporting fail that often disagree with other nodes: %v", result.LowTrustNodes)
+		if result.LowTrustDriven {
+			smsg += "\r\nThis alert is driven by these low-trust nodes, the remaining nodes would not have alerted."
+		}
+	}
+	return send(c.Email, []byte(smsg))
+}
+
+// SendNotice satisfies the alert.Notifier interface and sends a message about dpoller itself.
+func (c smtpContact) SendNotice(subject, body string) error {
+	return send(c.Email, []byte(fmt.Sprintf("To: %v\r\nSubject: Notice from dpoller: %v\r\n\r\n%v\r\n", c.Email,
+		subject, body)))
+}
+
+// send delivers a message to a single address through the configured relay.
+func send(to string, msg []byte) error {
 	auth := smtp.PlainAuth("", Config.Username, Config.Password, Config.Server)
 	host := Config.Server + ":" + Config.Port
-	err := smtp.SendMail(host, auth, "dpoller@example.com", to, msg)
-	return err
+	return smtp.SendMail(host, auth, "dpoller@example.com", []string{to}, msg)
 }
 
-// GetName satisfies half of the alert.Contact interface and exposes the contact name.
+// GetName satisfies part of the alert.Contact interface and exposes the contact name.
 func (c smtpContact) GetName() string {
 	return c.Name
 }
@@ -0,0 +1,57 @@
+// Package api serves read-only views of this node and the cluster over HTTP for operators and tooling. It's only
+// started when an api block is configured.
+package api
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/coordinate"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/members"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+)
+
+var log *logrus.Entry
+
+// Config describes where the API is served.
+type Config struct {
+	Bind string `json:"bind"` // e.g. "127.0.0.1:8080"
+}
+
+// Initialise starts the API server if one is configured. The configuration may be nil if none was provided.
+func Initialise(config *json.RawMessage, ll logrus.Level) error {
+
+	log = logger.New("api", ll)
+
+	if config == nil {
+		log.Debug("No API configured")
+		return nil
+	}
+	var c Config
+	if err := json.Unmarshal(*config, &c); err != nil {
+		return errors.Wrap(err, "could not parse API configuration")
+	}
+	if c.Bind == "" {
+		return errors.New("missing bind field")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/members", members.Handler)
+	mux.HandleFunc("/cluster", coordinate.Handler)
+	mux.Handle("/debug/vars", expvar.Handler())
+	ln, err := net.Listen("tcp", c.Bind)
+	if err != nil {
+		return errors.Wrap(err, "could not start API server")
+	}
+	server := &http.Server{Handler: mux}
+
+	// The API isn't needed for the node to do its job, so a later failure is only logged
+	go func() {
+		log.WithError(server.Serve(ln)).Error("API server stopped")
+	}()
+	log.WithField("bind", c.Bind).Info("Serving API")
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alowde/dpoller/members"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// commands are run instead of starting a node when named as the first argument. Each receives the address of a
+// running node's API.
+var commands = map[string]func(w io.Writer, api string) error{
+	"members": printMembers,
+}
+
+// printMembers lists the members known to a running node.
+func printMembers(w io.Writer, api string) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(strings.TrimSuffix(api, "/") + "/members")
+	if err != nil {
+		return errors.Wrap(err, "could not reach node API")
+	}
+	defer logClose(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("node API returned %v", res.Status)
+	}
+	var ms []members.Member
+	if err := json.NewDecoder(res.Body).Decode(&ms); err != nil {
+		return errors.Wrap(err, "could not parse membership view")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tEIP\tVERSION\tROLE\tFIRST SEEN\tLAST SEEN\tLABELS")
+	for _, m := range ms {
+		var labels []string
+		for k, v := range m.Labels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", m.ID, m.Name, m.EIP, m.Version, m.Role,
+			m.FirstSeen.Format(time.RFC3339), m.LastSeen.Format(time.RFC3339), strings.Join(labels, ","))
+	}
+	return tw.Flush()
+}
@@ -25,13 +25,19 @@ func logClose(c io.Closer) {
 // Skeleton contains raw configuration data for use by various modules throughout the application. It explicitly
 // contains opaque configuration data with the exception of the configDetails, which is for use by this package.
 type Skeleton struct {
-	Listen   *json.RawMessage `json:"listeners"`
-	Publish  *json.RawMessage `json:"publishers"`
-	Alert    *json.RawMessage `json:"alerters"`
-	Contacts *json.RawMessage `json:"contacts"`
-	Tests    *json.RawMessage `json:"urls"`
-	Config   *configDetails   `json:"config"`
-	logger   *log.Entry
+	Listen     *json.RawMessage `json:"listeners"`
+	Publish    *json.RawMessage `json:"publishers"`
+	Alert      *json.RawMessage `json:"alerters"`
+	Contacts   *json.RawMessage `json:"contacts"`
+	Tests      *json.RawMessage `json:"urls"`
+	Security   *json.RawMessage `json:"security"`
+	Coordinate *json.RawMessage `json:"coordinate"`
+	Consensus  *json.RawMessage `json:"consensus"`
+	Cluster    *json.RawMessage `json:"cluster"`
+	Node       *json.RawMessage `json:"node"`
+	API        *json.RawMessage `json:"api"`
+	Config     *configDetails   `json:"config"`
+	logger     *log.Entry
 }
 
 type configDetails struct {
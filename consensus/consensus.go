@@ -1,25 +1,49 @@
 // Package consensus contains the consensus routine that's responsible for determining whether enough nodes report
-// failure to send an alert. It runs continuously but only acts when the node is acting as a coordinator.
+// failure to send an alert. It runs continuously but only acts when the node holds the Coordinator lease. Each node's
+// latest status for a check counts until it's older than a window sized from the check's test interval. A check only
+// passes or fails once enough nodes have reported on it, and a check nobody reports on raises its own alert. Each
+// status is also scored against the majority, so nodes that often disagree count for less, see check.Trust. Particular
+// nodes can be given more or less say in the consensus configuration, see check.Weights.
 // Consensus is one of four routines that must send a heartbeat for the node to be considered healthy.
 package consensus
 
 import (
+	"encoding/json"
+	"expvar"
 	"github.com/Sirupsen/logrus"
 	"github.com/alowde/dpoller/alert"
 	"github.com/alowde/dpoller/heartbeat"
 	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/members"
 	"github.com/alowde/dpoller/url"
 	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
 	"time"
 )
 
 var log *logrus.Entry
 
-// Initialise starts the consensus-checking routine and returns a status channel.
-func Initialise(in chan check.Status, ll logrus.Level) (routineStatus chan error, err error) {
+// Config holds the consensus settings of the nodes evaluating it.
+type Config struct {
+	Weights check.Weights `json:"weights"`
+}
+
+// Initialise starts the consensus-checking routine and returns a status channel. The configuration may be nil if none
+// was provided.
+func Initialise(config *json.RawMessage, in chan check.Status, ll logrus.Level) (routineStatus chan error, err error) {
 
 	log = logger.New("consensus", ll)
 
+	var c Config
+	if config != nil {
+		if err := json.Unmarshal(*config, &c); err != nil {
+			return nil, errors.Wrap(err, "could not parse consensus configuration")
+		}
+	}
+	if err := check.SetWeights(c.Weights); err != nil {
+		return nil, errors.Wrap(err, "invalid consensus weights")
+	}
+
 	routineStatus = make(chan error, 10)
 	go checkConsensus(in, routineStatus)
 
@@ -27,36 +51,164 @@ func Initialise(in chan check.Status, ll logrus.Level) (routineStatus chan error
 }
 
 func checkConsensus(in chan check.Status, routineStatus chan error) {
+	w := newWindow(time.Now())
+	// Statuses are kept for as long as they're relevant to their check, so consensus can be checked as often as we like
+	// without losing data. Every node keeps track of consensus so a new Coordinator can act at once, but only the
+	// coordinator alerts, and only while its lease is current.
+	ticker := time.NewTicker(heartbeat.RoutineInterval())
+	defer ticker.Stop()
 	for {
-		var urlStatuses check.Statuses
-		interval := time.After(60 * time.Second)
-	collectLoop:
-		for {
-			select {
-			case <-interval:
-				if heartbeat.GetCoordinator() { // Only the coordinator checks URL statuses
-					dd := urlStatuses.Dedupe()
-					statusSet := dd.PerCheckName() // Dedupe and group status check results by name
-					log.WithField("status count", len(statusSet)).
-						Info("checking consensus")
-					for n, statuses := range statusSet { // Calculate the aggregate statistics for each set of checks
-						if r, err := statuses.CalculateResult(); err == nil { // Ignore empty statussets
-							c, _ := url.Checks.ByName(n)          // Get an absolute copy of the check configuration
-							if r.PassPercent < c.AlertThreshold { // If the result PassPercent is lower than the configd
-								log.WithField("check name", c.Name).
-									WithField("alert threshold", r.PassPercent).
-									WithField("passed checks", r.PassPercent).
-									Debug("alerting on failed check")
-								alert.Send(c, r) // check threshold, send an alert
-							}
-						}
-					}
-				}
-				routineStatus <- heartbeat.RoutineNormal{Timestamp: time.Now()}
-				break collectLoop
-			case s := <-in:
-				urlStatuses = append(urlStatuses, s)
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			w.expire(url.Checks, now)
+			forgetDeparted()
+			verdicts := evaluate(w, url.Checks, liveProbers(), now)
+			log.WithField("check count", len(verdicts)).Debug("checked consensus")
+			for _, v := range verdicts {
+				act(v, heartbeat.HoldsLease())
+			}
+			publishTrust()
+			routineStatus <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+		case s := <-in:
+			w.add(s, time.Now())
+		}
+	}
+}
+
+// State is the outcome of consensus for a single check.
+type State string
+
+// States a check can be in.
+const (
+	Passing      State = "passing"
+	Failing      State = "failing"
+	Insufficient State = "insufficient-data" // too few nodes reported to trust the result either way
+	NoReports    State = "no-reports"
+)
+
+// States exposes the latest State of each check.
+var States = expvar.NewMap("consensus_checks")
+
+// Trust exposes the trust score of each node by name.
+var Trust = expvar.NewMap("node_trust")
+
+// verdict is the consensus reached on a single check.
+type verdict struct {
+	check     check.Check
+	state     State
+	result    check.Result
+	reporting int // nodes that reported
+	required  int // nodes needed for a result
+	silent    int // whole windows since the check last had a report
+}
+
+// evaluate reaches a verdict on every configured check from the statuses retained in the window. live is the number
+// of nodes currently running checks, used for percentage quorums.
+func evaluate(w *window, checks check.Checks, live int, now time.Time) (verdicts []verdict) {
+	for _, c := range checks {
+		statuses := probing(w.current(c.Name))
+		v := verdict{check: c, reporting: len(statuses), required: c.MinReporting.Required(live)}
+		switch {
+		case len(statuses) == 0:
+			v.state = NoReports
+			v.silent = int(w.silence(c.Name, now) / span(c))
+		case len(statuses) < v.required:
+			v.state = Insufficient
+		default:
+			v.result, _ = statuses.CalculateResultBy(c.Consensus.By) // never empty here
+			if v.state = Passing; c.Failing(v.result) {
+				v.state = Failing
+				v.result.LowTrustDriven = c.DrivenByLowTrust(statuses)
+			}
+			// Trust is only scored once there's a quorum, so a lone early report can't be outvoted by nobody
+			c.UpdateTrust(statuses, probing(w.fresh(c.Name)))
+		}
+		verdicts = append(verdicts, v)
+	}
+	return
+}
+
+// act records a verdict and, on the Coordinator, sends any alert it calls for.
+func act(v verdict, coordinator bool) {
+	c := v.check
+	var state expvar.String
+	state.Set(string(v.state))
+	States.Set(c.Name, &state)
+
+	l := log.WithFields(logrus.Fields{
+		"check name": c.Name,
+		"state":      v.state,
+		"reporting":  v.reporting,
+		"required":   v.required,
+	})
+	switch v.state {
+	case Failing:
+		l = l.WithField("alert threshold", c.AlertThreshold).
+			WithField("passed checks", v.result.PassPercent).
+			WithField("failing groups", c.FailingGroups(v.result)).
+			WithField("low-trust nodes", v.result.LowTrustNodes)
+		if v.result.LowTrustDriven {
+			l.Info("alerting on failed check, driven by low-trust nodes")
+		} else {
+			l.Debug("alerting on failed check")
+		}
+		if coordinator {
+			alert.Send(c, v.result) // check threshold, send an alert
+		}
+	case Insufficient:
+		l.Info("too few nodes reported to reach consensus")
+	case NoReports:
+		l = l.WithField("silent windows", v.silent)
+		if c.SilentWindows > 0 && v.silent >= c.SilentWindows {
+			l.Warn("no node has reported on check")
+			if coordinator {
+				alert.SendNoReports(c, v.silent)
 			}
+		} else {
+			l.Debug("no reports on check this window")
+		}
+	}
+}
+
+// forgetDeparted drops the trust scores of nodes that have left the membership view.
+func forgetDeparted() {
+	names := make(map[string]bool)
+	for _, m := range members.List() {
+		names[m.Name] = true
+	}
+	check.ForgetTrust(func(name string) bool { return names[name] })
+}
+
+// publishTrust records each node's trust score, replacing those of departed nodes.
+func publishTrust() {
+	Trust.Init()
+	for name, t := range check.TrustScores() {
+		var score expvar.Float
+		score.Set(t)
+		Trust.Set(name, &score)
+	}
+}
+
+// liveProbers returns the number of live nodes in the membership view that run checks.
+func liveProbers() (n int) {
+	for _, m := range members.List() {
+		if m.NodeRole.Probes() {
+			n++
+		}
+	}
+	return
+}
+
+// probing drops statuses from nodes the membership view knows don't run checks. Such nodes shouldn't send any, but one
+// that's misconfigured would otherwise skew the pass percentage with probes from a vantage point we chose to exclude.
+func probing(s check.Statuses) (r check.Statuses) {
+	for _, v := range s {
+		if m, ok := members.Get(v.Node.ID); ok && !m.NodeRole.Probes() {
+			log.WithField("node", v.Node.ID).Debug("ignoring status from a node that doesn't probe")
+			continue
 		}
+		r = append(r, v)
 	}
+	return
 }
@@ -0,0 +1,106 @@
+package consensus
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/url/check"
+	"testing"
+	"time"
+)
+
+// report adds a status from each of the given nodes, in order of their status codes.
+func report(w *window, c check.Check, at time.Time, codes ...int) {
+	for i, code := range codes {
+		w.add(check.Status{Node: node.Node{ID: int64(i + 1)}, Url: c, StatusCode: code, Timestamp: int(at.Unix())}, at)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+
+	log = logger.New("consensus", logrus.FatalLevel)
+
+	var checks check.Checks
+	if err := json.Unmarshal([]byte(`[
+		{"name": "any", "ok-statuses": [200], "alert-below": 50},
+		{"name": "three", "ok-statuses": [200], "alert-below": 50, "min-reporting-nodes": 3},
+		{"name": "half", "ok-statuses": [200], "alert-below": 50, "min-reporting-nodes": "50%"},
+		{"name": "quiet", "ok-statuses": [200], "alert-below": 50, "no-report-windows": 2}
+	]`), &checks); err != nil {
+		t.Fatalf("Error parsing checks: %v", err)
+	}
+	now := time.Now()
+	w := newWindow(now)
+	report(w, checks[0], now, 500)
+	report(w, checks[1], now, 500, 500)
+	report(w, checks[2], now, 200, 200, 500)
+
+	// A single failure is enough without a quorum, two of an absolute three isn't and three of six live nodes is half
+	expected := []State{Failing, Insufficient, Passing, NoReports}
+	for i, v := range evaluate(w, checks, 6, now) {
+		if v.state != expected[i] {
+			t.Errorf("Error in evaluate() for check %q, expected %v, got %v", v.check.Name, expected[i], v.state)
+		}
+	}
+	if v := evaluate(w, checks, 8, now); v[2].state != Insufficient || v[2].required != 4 {
+		t.Errorf("Error in evaluate(), expected 4 of 8 live nodes to be required, got %v of %v", v[2].state,
+			v[2].required)
+	}
+	later := now.Add(2*span(checks[3]) + time.Second)
+	if v := evaluate(w, checks, 6, later); v[3].silent != 2 {
+		t.Errorf("Error in evaluate(), expected 2 silent windows, got %v", v[3].silent)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	slow := check.Check{Name: "slow", OkStatus: []int{200}, AlertThreshold: 50, TestInterval: 300}
+	fast := check.Check{Name: "fast", OkStatus: []int{200}, AlertThreshold: 50, TestInterval: 10}
+	checks := check.Checks{slow, fast}
+
+	start := time.Now()
+	w := newWindow(start)
+	report(w, slow, start, 200, 500)
+	report(w, fast, start, 200, 500)
+
+	// A newer result from a node replaces its older one, but an older one arriving late doesn't
+	later := start.Add(4 * time.Minute)
+	report(w, slow, later, 200, 200)
+	report(w, slow, start.Add(-time.Minute), 500, 500)
+	w.expire(checks, later)
+
+	if s := w.current("slow"); len(s) != 2 || s[0].StatusCode != 200 || s[1].StatusCode != 200 {
+		t.Errorf("Error in window, expected the latest passing results for the slow check, got %v", s)
+	}
+	// The fast check's results are older than its span, but the slow check's span covers several minutes
+	if s := w.current("fast"); len(s) != 0 {
+		t.Errorf("Error in window, expected the fast check's results to expire, got %v", s)
+	}
+	if d := span(slow); d != 10*time.Minute {
+		t.Errorf("Error in span(), expected twice the test interval, got %v", d)
+	}
+
+	// Each status is scored towards its node's trust once, until a newer one replaces it
+	if f := w.fresh("slow"); len(f) != 2 || len(w.fresh("slow")) != 0 {
+		t.Errorf("Error in fresh(), expected each status to be returned once, got %v", f)
+	}
+	report(w, slow, later.Add(time.Second), 500)
+	if f := w.fresh("slow"); len(f) != 1 || f[0].StatusCode != 500 {
+		t.Errorf("Error in fresh(), expected only the newer status, got %v", f)
+	}
+
+	// A delayed or replayed status counts from when it was recorded, not when it arrived
+	old := check.Status{Node: node.Node{ID: 7}, Url: fast, StatusCode: 500, Timestamp: int(later.Add(-time.Hour).Unix())}
+	w.add(old, later)
+	w.expire(checks, later)
+	if s := w.current("fast"); len(s) != 0 {
+		t.Errorf("Error in window, expected an old status to expire at once, got %v", s)
+	}
+
+	// Checks that are no longer configured are forgotten
+	w.expire(check.Checks{fast}, later)
+	if len(w.latest) != 0 || len(w.lastReport) != 1 {
+		t.Errorf("Error in expire(), expected unconfigured checks to be forgotten, got %v and %v", w.latest,
+			w.lastReport)
+	}
+}
@@ -0,0 +1,117 @@
+package consensus
+
+import (
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"time"
+)
+
+// entry is a status along with its age for expiry, see add.
+type entry struct {
+	check.Status
+	received time.Time // the older of when the status was recorded and when we received it
+	scored   bool      // whether the status has counted towards its node's trust, see fresh
+}
+
+// window retains each node's latest status for every check until it expires. It's only used by the consensus routine
+// and isn't safe for concurrent use.
+type window struct {
+	latest     map[string]map[int64]entry // by check name, then node ID
+	lastReport map[string]time.Time       // when each check last received a status
+	started    time.Time
+}
+
+func newWindow(now time.Time) *window {
+	return &window{
+		latest:     make(map[string]map[int64]entry),
+		lastReport: make(map[string]time.Time),
+		started:    now,
+	}
+}
+
+// span returns how long a check's statuses count towards consensus: long enough to hold one result from every node
+// even if a test run is delayed, and never shorter than the cluster's consensus window.
+func span(c check.Check) time.Duration {
+	d := 2 * time.Duration(c.TestInterval) * time.Second
+	if min := heartbeat.ConsensusWindow(); d < min {
+		return min
+	}
+	return d
+}
+
+// add records a status, replacing any older status from the same node for the same check. A status is aged from when
+// it was recorded, as it may have been delayed or sat in a transport's history for some time, unless that's in our
+// future: a node whose clock is ahead of ours can't keep its results alive for longer.
+func (w *window) add(s check.Status, now time.Time) {
+	name := s.Url.Name
+	nodes, ok := w.latest[name]
+	if !ok {
+		nodes = make(map[int64]entry)
+		w.latest[name] = nodes
+	}
+	if e, ok := nodes[s.Node.ID]; ok && e.Timestamp > s.Timestamp {
+		return
+	}
+	received := now
+	if recorded := time.Unix(int64(s.Timestamp), 0); recorded.Before(now) {
+		received = recorded
+	}
+	nodes[s.Node.ID] = entry{Status: s, received: received}
+	if received.After(w.lastReport[name]) {
+		w.lastReport[name] = received
+	}
+}
+
+// expire forgets statuses that have outlived their check's span, along with checks that are no longer configured.
+func (w *window) expire(checks check.Checks, now time.Time) {
+	spans := make(map[string]time.Duration, len(checks))
+	for _, c := range checks {
+		spans[c.Name] = span(c)
+	}
+	for name, nodes := range w.latest {
+		d, ok := spans[name]
+		for id, e := range nodes {
+			if !ok || now.Sub(e.received) > d {
+				delete(nodes, id)
+			}
+		}
+		if len(nodes) == 0 {
+			delete(w.latest, name)
+		}
+	}
+	for name := range w.lastReport {
+		if _, ok := spans[name]; !ok {
+			delete(w.lastReport, name)
+		}
+	}
+}
+
+// current returns the retained statuses for a check.
+func (w *window) current(name string) (s check.Statuses) {
+	for _, e := range w.latest[name] {
+		s = append(s, e.Status)
+	}
+	return
+}
+
+// fresh returns the retained statuses for a check that haven't yet counted towards their node's trust, and marks them
+// as counted.
+func (w *window) fresh(name string) (s check.Statuses) {
+	for id, e := range w.latest[name] {
+		if !e.scored {
+			s = append(s, e.Status)
+			e.scored = true
+			w.latest[name][id] = e
+		}
+	}
+	return
+}
+
+// silence returns how long a check has gone without a status, counting from when we started if it's never had one.
+func (w *window) silence(name string, now time.Time) time.Duration {
+	last, ok := w.lastReport[name]
+	if !ok {
+		last = w.started
+	}
+	return now.Sub(last)
+}
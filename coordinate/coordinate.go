@@ -1,14 +1,17 @@
 // Package coordinate contains the coordinate routine that's responsible for electing a Coordinator and Feasible
 // Coordinator node. Normally the node generates a heartbeat every 30 seconds, but the C and FC nodes generate a
-// heartbeat every five seconds to reduce downtime.
+// heartbeat every five seconds to reduce downtime. Both intervals can be changed in the cluster configuration.
 // Coordinate is one of four routines that must send a heartbeat for the node to be considered healthy.
 package coordinate
 
 import (
+	"encoding/json"
 	"github.com/Sirupsen/logrus"
 	"github.com/alowde/dpoller/heartbeat"
 	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/members"
 	"github.com/alowde/dpoller/node"
+	"github.com/pkg/errors"
 	"time"
 )
 
@@ -16,11 +19,64 @@ var knownBeats heartbeat.BeatMap
 
 var log *logrus.Entry
 
-// Initialise starts the consensus-checking routine and returns a status channel.
-func Initialise(in chan heartbeat.Beat, ll logrus.Level) (statusReport chan error, err error) {
+// Config selects how the Coordinator is elected. Every node in a cluster must use the same strategy.
+type Config struct {
+	Strategy string     `json:"strategy"`             // "heartbeat" (default) or "raft"
+	Priority int        `json:"coordinator-priority"` // higher-priority nodes are preferred, heartbeat strategy only
+	Eligible *bool      `json:"coordinator-eligible"` // set false to never hold the Coordinator role, defaults true
+	Ops      []string   `json:"ops-contacts"`         // contacts notified of split-brain or leaderless clusters
+	Raft     raftConfig `json:"raft"`
+}
+
+// strategy decides whether this node holds the Coordinator and Feasible Coordinator roles.
+type strategy interface {
+	evaluate(beats heartbeat.Beats) (heartbeat.Decision, error)
+}
+
+// heartbeatStrategy elects the highest-ranked node from the heartbeats each node has seen. It needs no configuration but
+// during a partition each side may elect its own Coordinator.
+type heartbeatStrategy struct{}
+
+func (heartbeatStrategy) evaluate(beats heartbeat.Beats) (heartbeat.Decision, error) {
+	return beats.Evaluate(heartbeat.GetCoordinator(), heartbeat.GetFeasibleCoordinator(), node.Self.ID)
+}
+
+var elect strategy
+
+// reevaluate is signalled by a strategy that learns of a change in leadership between intervals, so roles can change
+// straight away while still only being changed by the coordinate routine.
+var reevaluate = make(chan struct{}, 1)
+
+// Initialise starts the consensus-checking routine and returns a status channel. The configuration may be nil if
+// none was provided.
+func Initialise(config *json.RawMessage, in chan heartbeat.Beat, ll logrus.Level) (statusReport chan error, err error) {
 
 	log = logger.New("coordinate", ll)
 
+	var c Config
+	if config != nil {
+		if err := json.Unmarshal(*config, &c); err != nil {
+			return nil, errors.Wrap(err, "could not parse coordinate configuration")
+		}
+	}
+	heartbeat.SetPriority(c.Priority)
+	heartbeat.SetEligible(node.SelfRole.MayCoordinate() && (c.Eligible == nil || *c.Eligible))
+	if !node.SelfRole.MayCoordinate() && c.Eligible != nil && *c.Eligible {
+		log.WithField("role", node.SelfRole).Warn("Ignoring coordinator-eligible, this node's role can't coordinate")
+	}
+	opsContacts = c.Ops
+
+	switch c.Strategy {
+	case "", "heartbeat":
+		elect = heartbeatStrategy{}
+	case "raft":
+		if elect, err = newRaftStrategy(c.Raft); err != nil {
+			return nil, errors.Wrap(err, "could not start raft")
+		}
+	default:
+		return nil, errors.Errorf("unknown strategy %q, expected heartbeat or raft", c.Strategy)
+	}
+
 	statusReport = make(chan error, 10)
 	knownBeats = heartbeat.NewBeatMap()
 	go updateKnownBeats(in, statusReport)
@@ -33,38 +89,141 @@ func updateKnownBeats(in chan heartbeat.Beat, statusReport chan error) {
 
 timer:
 	for {
-		var interval time.Duration
-		if heartbeat.GetCoordinator() || heartbeat.GetFeasibleCoordinator() {
-			interval = 5 * time.Second
-		} else {
-			interval = 30 * time.Second
-		}
-		coordTimer := time.After(interval)
+		coordTimer := time.After(heartbeat.BeatInterval())
 		for {
 			select {
 			case <-coordTimer:
 				log.Debug("interval expired")
-				// when interval expires, delete beats of nodes that haven't been seen for 21 seconds and evaluate
+				// when interval expires, delete beats of nodes that haven't been seen within the age-out and evaluate
 				log.WithField("nodes", knownBeats.GetNodes()).Debug("Aging out nodes")
 				knownBeats.AgeOut()
-				// update the beatmap with our own heartbeat
-				knownBeats[node.Self.ID] = heartbeat.NewBeat()
-				log.WithField("nodes", knownBeats.GetNodes()).Debug("Evaluating nodes")
-				c, f := knownBeats.ToBeats().Evaluate(heartbeat.GetCoordinator(), heartbeat.GetFeasibleCoordinator(), node.Self.ID)
-				heartbeat.SetCoordinator(c)
-				heartbeat.SetFeasibleCoordinator(f)
-				log.WithFields(logrus.Fields{
-					"coordinators":         knownBeats.ToBeats().CoordCount(),
-					"feasibleCoordinators": knownBeats.ToBeats().FeasCount(),
-					"is_coordinator":       heartbeat.GetCoordinator(),
-					"is_feasible":          heartbeat.GetFeasibleCoordinator(),
-				}).Info("Finished evaluating feasible/coordinators")
+				decide()
 				statusReport <- heartbeat.RoutineNormal{Timestamp: time.Now()}
 				continue timer
+			case <-reevaluate:
+				log.Debug("strategy requested evaluation")
+				decide()
 			case b := <-in:
 				log.Debug("beat in")
+				if b.IsObituary() {
+					log.WithField("node", b.ID).Info("node announced its departure")
+					delete(knownBeats, b.ID)
+					continue
+				}
+				heartbeat.Observe(b.Epoch)
 				knownBeats[b.ID] = b
 			}
 		}
 	}
 }
+
+// decide runs the election over the known Beats, including our own, and takes on the resulting roles.
+func decide() {
+	// update the beatmap with our own heartbeat
+	knownBeats[node.Self.ID] = heartbeat.NewBeat()
+	log.WithField("nodes", knownBeats.GetNodes()).Debug("Evaluating nodes")
+	beats, d, err := evaluate(knownBeats)
+	if err != nil {
+		// Without a decision we can't be sure we're entitled to any role, so hold none until the next
+		log.WithError(err).Error("Could not evaluate feasible/coordinators, holding no roles")
+		d = heartbeat.Decision{Role: heartbeat.NoRole, Reason: "evaluation failed"}
+	}
+	assume(d, beats)
+	observe(beats)
+	members.Observe(knownBeats)
+	log.WithFields(logrus.Fields{
+		"coordinators":         knownBeats.ToBeats().CoordCount(),
+		"feasibleCoordinators": knownBeats.ToBeats().FeasCount(),
+		"is_coordinator":       heartbeat.GetCoordinator(),
+		"is_feasible":          heartbeat.GetFeasibleCoordinator(),
+		"term":                 heartbeat.GetTerm(),
+		"epoch":                heartbeat.GetEpoch(),
+		"reason":               d.Reason,
+		"known_coordinator":    d.Coordinator,
+	}).Info("Finished evaluating feasible/coordinators")
+}
+
+// evaluate runs the election over the known Beats. The election can't proceed without this node's own Beat, so if
+// it's missing it's re-inserted and the election retried once.
+func evaluate(bm heartbeat.BeatMap) (heartbeat.Beats, heartbeat.Decision, error) {
+	beats := bm.ToBeats()
+	d, err := elect.evaluate(beats)
+	if _, ok := err.(heartbeat.MissingSelfError); ok {
+		log.Warn("Own heartbeat was missing from the known beats, re-inserting")
+		bm[node.Self.ID] = heartbeat.NewBeat()
+		beats = bm.ToBeats()
+		d, err = elect.evaluate(beats)
+	}
+	return beats, d, err
+}
+
+// assume takes on the roles chosen by the election strategy and maintains the Coordinator lease to match.
+func assume(d heartbeat.Decision, beats heartbeat.Beats) {
+	c, f := d.IsCoordinator(), d.IsFeasible()
+	if c && !lead(d, beats) {
+		c, f = false, false
+	}
+	if !c {
+		heartbeat.Release()
+	}
+	heartbeat.SetCoordinator(c)
+	heartbeat.SetFeasibleCoordinator(f)
+}
+
+// lead takes or renews the lease for a node the strategy chose as Coordinator, and reports whether it should hold the
+// role. When more than one node claims the Coordinator role, every node but the Winner stands down, whatever the
+// strategy decided. Only a node that still holds its lease may contest the role: a new lease always has the latest
+// epoch and would win, so one isn't taken while another Coordinator is visible. For the same reason a Coordinator whose
+// lease lapsed waits until it's caught up with the cluster, see heartbeat.MayAcquire. A strategy that numbers its own
+// terms chooses the lease epoch itself.
+func lead(d heartbeat.Decision, beats heartbeat.Beats) bool {
+	if d.Epoch != 0 {
+		if !heartbeat.AcquireAt(d.Epoch) {
+			log.WithFields(logrus.Fields{
+				"epoch":  d.Epoch,
+				"latest": heartbeat.GetEpoch(),
+			}).Warn("Can't take a Coordinator lease older than one already held, standing down")
+			return false
+		}
+	} else if !heartbeat.GetCoordinator() || !heartbeat.Renew() {
+		if w, ok := others(beats).Winner(); ok {
+			log.WithFields(logrus.Fields{
+				"node":  w.ID,
+				"epoch": w.Epoch,
+			}).Warn("Another Coordinator holds the role, not taking a lease")
+			return false
+		}
+		if !heartbeat.MayAcquire() {
+			log.Warn("Coordinator lease lapsed, waiting to hear from the cluster before taking another")
+			return false
+		}
+		epoch := heartbeat.Acquire(beats.MaxEpoch())
+		log.WithField("epoch", epoch).Info("Acquired Coordinator lease")
+	}
+	if w, _ := append(others(beats), claim()).Winner(); w.ID != node.Self.ID {
+		log.WithFields(logrus.Fields{
+			"node":  w.ID,
+			"epoch": w.Epoch,
+		}).Warn("Another Coordinator takes precedence, standing down")
+		return false
+	}
+	return true
+}
+
+// claim returns this node's Beat claiming the Coordinator role under its current lease.
+func claim() heartbeat.Beat {
+	self := heartbeat.NewBeat()
+	self.Coordinator = true
+	self.Epoch = heartbeat.GetEpoch()
+	return self
+}
+
+// others returns the Beats from every node but this one.
+func others(beats heartbeat.Beats) (o heartbeat.Beats) {
+	for _, b := range beats {
+		if b.ID != node.Self.ID {
+			o = append(o, b)
+		}
+	}
+	return
+}
@@ -0,0 +1,176 @@
+package coordinate
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/node"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingStrategy never finds this node among the Beats.
+type failingStrategy struct{ calls int }
+
+func (s *failingStrategy) evaluate(heartbeat.Beats) (heartbeat.Decision, error) {
+	s.calls++
+	return heartbeat.Decision{}, heartbeat.MissingSelfError{ID: node.Self.ID}
+}
+
+func TestEvaluate(t *testing.T) {
+
+	log = logger.New("coordinate", logrus.FatalLevel)
+	heartbeat.Initialise(logrus.FatalLevel)
+	node.Self = node.Node{ID: 42, Name: "self"}
+	defer func() { node.Self = node.Node{} }()
+
+	// Our own Beat is missing, so it's re-inserted and the election retried
+	elect = heartbeatStrategy{}
+	other := heartbeat.Beat{Node: node.Node{ID: 7}, Timestamp: time.Now()}
+	bm := heartbeat.BeatMap{other.ID: other}
+	beats, d, err := evaluate(bm)
+	if err != nil {
+		t.Fatalf("Error in evaluate() with self missing, expected a retry to succeed, got %v", err)
+	}
+	if _, ok := bm[node.Self.ID]; !ok || len(beats) != 2 {
+		t.Errorf("Error in evaluate(), expected own Beat to be re-inserted, got %v", bm.GetNodes())
+	}
+	if d.Reason == "" {
+		t.Errorf("Error in evaluate(), expected a reason for the decision")
+	}
+
+	// Only one retry is made before the error is returned
+	s := &failingStrategy{}
+	elect = s
+	if _, _, err := evaluate(heartbeat.BeatMap{}); err == nil || s.calls != 2 {
+		t.Errorf("Error in evaluate() with a failing strategy, expected an error after 2 calls, got %v after %v",
+			err, s.calls)
+	}
+}
+
+func TestRaftConfig(t *testing.T) {
+	tables := []struct {
+		description string
+		conf        raftConfig
+		ok          bool
+	}{
+		{"private bind", raftConfig{Bind: "10.0.0.1:8300", Peers: []string{"10.0.0.1:8300", "10.0.0.2:8300"}}, true},
+		{"loopback bind", raftConfig{Bind: "127.0.0.1:8300", Peers: []string{"127.0.0.1:8300"}}, true},
+		{"all interfaces", raftConfig{Bind: ":8300", Peers: []string{":8300"}}, false},
+		{"public bind", raftConfig{Bind: "203.0.113.1:8300", Peers: []string{"203.0.113.1:8300"}}, false},
+		{"not a peer", raftConfig{Bind: "10.0.0.1:8300", Peers: []string{"10.0.0.2:8300"}}, false},
+	}
+	for _, table := range tables {
+		if err := table.conf.validate(); (err == nil) != table.ok {
+			t.Errorf("Error in validate() for case %q, expected success %v, got %v", table.description, table.ok, err)
+		}
+	}
+}
+
+// TestSplitBrain checks that a node the strategy chooses as Coordinator doesn't take a lease, which would be the latest
+// and win, while another Coordinator is visible. Of two Coordinators already holding leases the later one keeps the role.
+func TestSplitBrain(t *testing.T) {
+	log = logger.New("coordinate", logrus.FatalLevel)
+	heartbeat.Initialise(logrus.FatalLevel)
+	node.Self = node.Node{ID: 1, Name: "self"}
+	defer func() {
+		node.Self = node.Node{}
+		heartbeat.SetCoordinator(false)
+		heartbeat.Release()
+	}()
+	coordinate := heartbeat.Decision{Role: heartbeat.CoordinatorRole, Coordinator: node.Self.ID}
+	rival := func(epoch uint64) heartbeat.Beat {
+		return heartbeat.Beat{Node: node.Node{ID: 2}, Coordinator: true, Epoch: epoch, Timestamp: time.Now()}
+	}
+
+	before := heartbeat.GetEpoch()
+	assume(coordinate, heartbeat.Beats{heartbeat.NewBeat(), rival(before)})
+	if heartbeat.GetCoordinator() || heartbeat.GetEpoch() != before {
+		t.Errorf("Error in assume(), expected no lease to be taken while another Coordinator is visible")
+	}
+
+	// Once the rival has gone we take the role, and keep it against an earlier lease but not a later one
+	assume(coordinate, heartbeat.Beats{heartbeat.NewBeat()})
+	held := heartbeat.GetEpoch()
+	assume(coordinate, heartbeat.Beats{heartbeat.NewBeat(), rival(held - 1)})
+	if !heartbeat.GetCoordinator() || heartbeat.GetEpoch() != held {
+		t.Errorf("Error in assume(), expected lease %v to be kept against an earlier one", held)
+	}
+	assume(coordinate, heartbeat.Beats{heartbeat.NewBeat(), rival(held + 1)})
+	if heartbeat.GetCoordinator() || heartbeat.HoldsLease() {
+		t.Errorf("Error in assume(), expected to stand down for a later lease")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	log = logger.New("coordinate", logrus.FatalLevel)
+	defer func() { health.reported = Healthy }()
+
+	tables := []struct {
+		condition Condition
+		status    int
+	}{
+		{Healthy, http.StatusOK},
+		{SplitBrain, http.StatusServiceUnavailable},
+		{Leaderless, http.StatusServiceUnavailable},
+	}
+	for _, table := range tables {
+		health.reported = table.condition
+		w := httptest.NewRecorder()
+		Handler(w, httptest.NewRequest("GET", "/cluster", nil))
+		var view struct{ Condition Condition }
+		if err := json.NewDecoder(w.Body).Decode(&view); err != nil {
+			t.Fatalf("Received error %v", err)
+		}
+		if w.Code != table.status || view.Condition != table.condition {
+			t.Errorf("Error in Handler() for case %q, got status %v and condition %q", table.condition, w.Code,
+				view.Condition)
+		}
+	}
+}
+
+// TestPausedCoordinator wakes a Coordinator whose lease lapsed while it was paused and another node took over. It
+// must stand down rather than take a fresh lease, and the new Coordinator's lease must be the later one. No new lease
+// can be taken for an age-out period afterwards, so this test is kept last.
+func TestPausedCoordinator(t *testing.T) {
+	log = logger.New("coordinate", logrus.FatalLevel)
+	heartbeat.Initialise(logrus.FatalLevel)
+	node.Self = node.Node{ID: 1, Name: "self"}
+	timing := heartbeat.Timing
+	defer func() {
+		node.Self = node.Node{}
+		heartbeat.Timing = timing
+		heartbeat.SetCoordinator(false)
+		heartbeat.Release()
+	}()
+
+	// A zero lease expires as soon as it's taken, as though the node was paused straight afterwards
+	heartbeat.Timing.Lease = 0
+	coordinate := heartbeat.Decision{Role: heartbeat.CoordinatorRole, Coordinator: node.Self.ID}
+	assume(coordinate, heartbeat.Beats{heartbeat.NewBeat()})
+	paused := heartbeat.GetEpoch()
+
+	// Meanwhile the Feasible Coordinator, which had seen our lease, took over with a later one
+	heartbeat.Observe(paused)
+	successor := heartbeat.Beat{Node: node.Node{ID: 2}, Coordinator: true, Epoch: paused + 1, Timestamp: time.Now()}
+
+	// On waking, every other Beat has aged out so the election picks us, but the lapsed lease isn't replaced
+	heartbeat.Timing.Lease = timing.Lease
+	assume(coordinate, heartbeat.Beats{heartbeat.NewBeat()})
+	if heartbeat.GetCoordinator() || heartbeat.HoldsLease() || heartbeat.GetEpoch() != paused {
+		t.Errorf("Error in assume(), expected a lapsed Coordinator to stand down, got epoch %v", heartbeat.GetEpoch())
+	}
+
+	// Nor once the successor is heard from again
+	heartbeat.Observe(successor.Epoch)
+	assume(coordinate, heartbeat.Beats{heartbeat.NewBeat(), successor})
+	if heartbeat.GetCoordinator() {
+		t.Errorf("Error in assume(), expected a lapsed Coordinator to wait before taking a new lease")
+	}
+	if e := heartbeat.NewBeat().Epoch; e != successor.Epoch {
+		t.Errorf("Error in NewBeat(), expected the successor's epoch %v to be advertised, got %v", successor.Epoch, e)
+	}
+}
@@ -0,0 +1,108 @@
+package coordinate
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/alert"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"sync"
+	"time"
+)
+
+// Condition describes the Coordinator situation of the cluster as seen by this node.
+type Condition string
+
+// Conditions reported by Health.
+const (
+	Healthy    Condition = "healthy"     // exactly one Coordinator
+	SplitBrain Condition = "split-brain" // more than one Coordinator
+	Leaderless Condition = "leaderless"  // no Coordinator
+)
+
+// conditionGrace is how long a problem must persist before it's reported. Elections and handovers briefly pass
+// through both problem states: after a Coordinator fails the cluster is leaderless until its last Beat ages out and
+// the standby next evaluates, and the slowest nodes only notice changes once per node-interval.
+func conditionGrace() time.Duration {
+	return heartbeat.AgeOutAfter() + 2*time.Duration(heartbeat.Timing.NodeInterval)*time.Second
+}
+
+// Cluster exposes the reported condition, when it began and the number of Coordinators last seen.
+var Cluster = expvar.NewMap("cluster")
+
+var coordinators = new(expvar.Int)
+
+var health = struct {
+	sync.Mutex
+	observed Condition // condition at the last evaluation
+	since    time.Time // when the observed condition began
+	reported Condition // condition after the grace period
+}{observed: Healthy, reported: Healthy, since: time.Now()}
+
+// opsContacts are the names of the contacts notified when the cluster's condition changes.
+var opsContacts []string
+
+func init() {
+	Cluster.Set("coordinators", coordinators)
+	Cluster.Set("condition", expvar.Func(func() interface{} { return Health() }))
+	Cluster.Set("since", expvar.Func(func() interface{} {
+		health.Lock()
+		defer health.Unlock()
+		return health.since
+	}))
+}
+
+// Health returns the cluster's condition, ignoring problems that haven't yet lasted long enough to report.
+func Health() Condition {
+	health.Lock()
+	defer health.Unlock()
+	return health.reported
+}
+
+// observe records the cluster's condition from the latest set of Beats, and logs and reports any change that outlasts
+// the grace period.
+func observe(beats heartbeat.Beats) {
+	count := beats.CoordCount()
+	coordinators.Set(int64(count))
+
+	current := Healthy
+	switch {
+	case count == 0:
+		current = Leaderless
+	case count > 1:
+		current = SplitBrain
+	}
+
+	health.Lock()
+	defer health.Unlock()
+	if current != health.observed {
+		health.observed, health.since = current, time.Now()
+	}
+	if current == health.reported || (current != Healthy && time.Since(health.since) < conditionGrace()) {
+		return
+	}
+	previous := health.reported
+	health.reported = current
+
+	fields := logrus.Fields{
+		"condition":    current,
+		"previous":     previous,
+		"coordinators": count,
+		"since":        health.since,
+	}
+	if current == Healthy {
+		log.WithFields(fields).Info("Cluster has recovered a single Coordinator")
+	} else {
+		log.WithFields(fields).Error("Cluster Coordinator problem persisted beyond the grace period")
+	}
+
+	// Every node sees the problem, so only the node first in line for the Feasible Coordinator role reports it. That's
+	// never a Coordinator, which during a split may only be able to see itself.
+	if id, err := beats.Standby(); err != nil || id != node.Self.ID || len(opsContacts) == 0 {
+		return
+	}
+	go alert.Notify(opsContacts, fmt.Sprintf("cluster is %v", current), fmt.Sprintf(
+		"Node %v (%v) sees %v Coordinators among %v nodes. The cluster has been %v since %v, and was %v before.",
+		node.Self.Name, node.Self.EIP, count, len(beats), current, health.since.Format(time.RFC3339), previous))
+}
@@ -0,0 +1,27 @@
+package coordinate
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Handler serves the cluster's condition as JSON. The status is 503 Service Unavailable while the cluster is reported
+// split-brain or leaderless, so the endpoint can be used as a health check.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	health.Lock()
+	view := struct {
+		Condition    Condition `json:"condition"`
+		Since        time.Time `json:"since"`
+		Coordinators int64     `json:"coordinators"`
+	}{health.reported, health.since, coordinators.Value()}
+	health.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if view.Condition != Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		log.WithError(err).Warn("could not write cluster condition")
+	}
+}
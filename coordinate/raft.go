@@ -0,0 +1,197 @@
+package coordinate
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// raftConfig describes this node's place in a Raft cluster. Membership is static: every node lists the same peers.
+// Raft traffic is neither encrypted nor authenticated, unlike messages sealed by the envelope package, so anyone who
+// can reach the bind address can disrupt elections. It must be bound to a private address that only the cluster's
+// nodes can reach.
+type raftConfig struct {
+	Bind      string   `json:"bind"`      // private address to serve Raft on, e.g. "10.0.0.1:8300"
+	Advertise string   `json:"advertise"` // host:port other nodes use to reach us, defaults to bind
+	Peers     []string `json:"peers"`     // advertise addresses of every voting node, including this one
+	DataDir   string   `json:"data-dir"`  // where to keep Raft state, held in memory if empty
+}
+
+func (c *raftConfig) validate() error {
+	if c.Bind == "" {
+		return errors.New("missing bind field")
+	}
+	host, _, err := net.SplitHostPort(c.Bind)
+	if err != nil {
+		return errors.Wrap(err, "invalid bind field")
+	}
+	if ip := net.ParseIP(host); ip == nil || !(ip.IsLoopback() || ip.IsPrivate()) {
+		return errors.Errorf("bind address %v must be a private IP address, raft traffic isn't authenticated", host)
+	}
+	if c.Advertise == "" {
+		c.Advertise = c.Bind
+	}
+	for _, p := range c.Peers {
+		if p == c.Advertise {
+			return nil
+		}
+	}
+	return errors.Errorf("peers must include this node's advertise address %v", c.Advertise)
+}
+
+// raftStrategy makes the Raft leader the Coordinator. Raft only elects a leader with the support of a majority of the
+// peers, so a partition can't produce two Coordinators, and a leader that loses its majority steps down.
+type raftStrategy struct {
+	r            *raft.Raft
+	transferring chan struct{} // holds a value while a leadership transfer is running
+}
+
+// transferTimeout is how long the coordinate routine waits for a leadership transfer before allowing another attempt.
+const transferTimeout = 10 * time.Second
+
+func newRaftStrategy(c raftConfig) (*raftStrategy, error) {
+	if err := c.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid configuration")
+	}
+
+	// Raft's own logging is verbose, so only its warnings and errors are passed through
+	out := log.Logger.WriterLevel(logrus.WarnLevel)
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(c.Advertise) // node IDs change on every start, addresses don't
+	conf.LogOutput = out
+	conf.LogLevel = "WARN"
+
+	addr, err := net.ResolveTCPAddr("tcp", c.Advertise)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid advertise address")
+	}
+	transport, err := raft.NewTCPTransport(c.Bind, addr, 3, 10*time.Second, out)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not start raft transport")
+	}
+
+	var logs raft.LogStore
+	var stable raft.StableStore
+	var snaps raft.SnapshotStore
+	if c.DataDir == "" {
+		store := raft.NewInmemStore()
+		logs, stable, snaps = store, store, raft.NewInmemSnapshotStore()
+	} else {
+		if err := os.MkdirAll(c.DataDir, 0700); err != nil {
+			return nil, errors.Wrap(err, "could not create data-dir")
+		}
+		store, err := raftboltdb.NewBoltStore(filepath.Join(c.DataDir, "raft.db"))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not open raft store")
+		}
+		logs, stable = store, store
+		if snaps, err = raft.NewFileSnapshotStore(c.DataDir, 1, out); err != nil {
+			return nil, errors.Wrap(err, "could not open raft snapshot store")
+		}
+	}
+
+	r, err := raft.NewRaft(conf, fsm{}, logs, stable, snaps, transport)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create raft node")
+	}
+
+	// Every node bootstraps with the same configuration, which is safe. Nodes with existing state refuse.
+	var servers []raft.Server
+	for _, p := range c.Peers {
+		servers = append(servers, raft.Server{Suffrage: raft.Voter, ID: raft.ServerID(p), Address: raft.ServerAddress(p)})
+	}
+	if err := r.BootstrapCluster(raft.Configuration{Servers: servers}).Error(); err != nil && err != raft.ErrCantBootstrap {
+		return nil, errors.Wrap(err, "could not bootstrap raft cluster")
+	}
+
+	s := &raftStrategy{r: r, transferring: make(chan struct{}, 1)}
+	go s.watch()
+	log.WithFields(logrus.Fields{
+		"advertise": c.Advertise,
+		"peers":     len(c.Peers),
+	}).Info("Started raft coordinator election")
+	return s, nil
+}
+
+// watch asks the coordinate routine to evaluate as soon as leadership changes, rather than waiting for the next
+// interval. Roles are only ever changed by the coordinate routine.
+func (s *raftStrategy) watch() {
+	for leader := range s.r.LeaderCh() {
+		log.WithField("leader", leader).Info("Raft leadership changed")
+		select {
+		case reevaluate <- struct{}{}:
+		default: // an evaluation is already pending
+		}
+	}
+}
+
+func (s *raftStrategy) updateTerm() {
+	if t, err := strconv.ParseUint(s.r.Stats()["term"], 10, 64); err == nil {
+		heartbeat.SetTerm(t)
+	}
+}
+
+// evaluate ignores heartbeats, which are only used to track the other nodes. Raft handles failover itself, so no
+// node needs to stand by as the Feasible Coordinator. Raft has no notion of priority, but an ineligible node that wins
+// an election hands leadership to another peer straight away. Raft elects at most one leader in each term, so the
+// term is used as the Coordinator's lease epoch.
+func (s *raftStrategy) evaluate(heartbeat.Beats) (heartbeat.Decision, error) {
+	s.updateTerm()
+	if s.r.State() != raft.Leader {
+		return heartbeat.Decision{Role: heartbeat.NoRole, Reason: "raft follower"}, nil
+	}
+	if !heartbeat.GetEligible() {
+		s.handOff()
+		return heartbeat.Decision{Role: heartbeat.NoRole, Reason: "ineligible, handing off raft leadership"}, nil
+	}
+	return heartbeat.Decision{
+		Role:        heartbeat.CoordinatorRole,
+		Reason:      "raft leader",
+		Coordinator: node.Self.ID,
+		Epoch:       heartbeat.GetTerm(),
+	}, nil
+}
+
+// handOff transfers raft leadership to another peer without holding up the coordinate routine, which keeps evaluating
+// while the transfer runs. Only one transfer runs at a time.
+func (s *raftStrategy) handOff() {
+	select {
+	case s.transferring <- struct{}{}:
+	default:
+		return // a transfer is already running
+	}
+	go func() {
+		defer func() { <-s.transferring }()
+		done := make(chan error, 1)
+		go func() { done <- s.r.LeadershipTransfer().Error() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				log.WithError(err).Warn("Could not hand off raft leadership from an ineligible node")
+			}
+		case <-time.After(transferTimeout):
+			log.Warn("Timed out handing off raft leadership from an ineligible node")
+		}
+	}()
+}
+
+// fsm is an empty state machine. Only Raft's leader election is used, nothing is replicated.
+type fsm struct{}
+
+func (fsm) Apply(*raft.Log) interface{}         { return nil }
+func (fsm) Snapshot() (raft.FSMSnapshot, error) { return snapshot{}, nil }
+func (fsm) Restore(rc io.ReadCloser) error      { return rc.Close() }
+
+type snapshot struct{}
+
+func (snapshot) Persist(sink raft.SnapshotSink) error { return sink.Close() }
+func (snapshot) Release()                             {}
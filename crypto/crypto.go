@@ -5,9 +5,13 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/scrypt"
 	"io"
 )
@@ -15,6 +19,11 @@ import (
 // Decrypt decrypts data using 256-bit AES-GCM that has been encrypted in the format output provided by the Encrypt
 // function.
 func Decrypt(ciphertext []byte, key *[32]byte) (plaintext []byte, err error) {
+	return DecryptWithData(ciphertext, nil, key)
+}
+
+// DecryptWithData decrypts data encrypted by EncryptWithData, failing unless the same additional data is given.
+func DecryptWithData(ciphertext, data []byte, key *[32]byte) (plaintext []byte, err error) {
 	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, err
@@ -32,7 +41,7 @@ func Decrypt(ciphertext []byte, key *[32]byte) (plaintext []byte, err error) {
 	return gcm.Open(nil,
 		ciphertext[:gcm.NonceSize()],
 		ciphertext[gcm.NonceSize():],
-		nil,
+		data,
 	)
 }
 
@@ -48,6 +57,12 @@ func Decrypt64(ciphertext string, key *[32]byte) (plaintext []byte, err error) {
 // Encrypt encrypts data using 256-bit AES-GCM.  This both hides the content of the data and provides the ability to
 // verify that it hasn't been altered.
 func Encrypt(plaintext []byte, key *[32]byte) (ciphertext []byte, err error) {
+	return EncryptWithData(plaintext, nil, key)
+}
+
+// EncryptWithData is Encrypt with additional data, which isn't encrypted but is authenticated along with the
+// plaintext, binding the ciphertext to it.
+func EncryptWithData(plaintext, data []byte, key *[32]byte) (ciphertext []byte, err error) {
 	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, err
@@ -64,7 +79,7 @@ func Encrypt(plaintext []byte, key *[32]byte) (ciphertext []byte, err error) {
 		return nil, err
 	}
 
-	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+	return gcm.Seal(nonce, nonce, plaintext, data), nil
 }
 
 // Encrypt64 takes the same parameters as Encrypt but outputs a base64 encoded string suitable for exchange in ASCII
@@ -92,10 +107,47 @@ func Stretch(passphrase string, salt []byte) (key *[32]byte, err error) {
 		return nil, errors.New("passphrase is too short")
 	}
 	keySlice, err := scrypt.Key([]byte(passphrase), salt, 65536, 8, 4, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not stretch passphrase")
+	}
 	// scrypt only gives us back a slice so we explicitly check it before conversion
 	if len(keySlice) != 32 {
-		return nil, errors.Wrap(err, "invalid key returned")
+		return nil, errors.New("invalid key returned")
 	}
+	key = new([32]byte)
 	copy(key[:], keySlice)
 	return key, nil
 }
+
+// Derive expands a key produced by Stretch into a new key unique to the given salt using HKDF-SHA256. Stretch is
+// deliberately expensive so it's only run once per passphrase; Derive is cheap enough to give every message a key of
+// its own from a random salt.
+func Derive(key *[32]byte, salt []byte) (derived *[32]byte, err error) {
+	derived = new([32]byte)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key[:], salt, []byte("dpoller message key")), derived[:]); err != nil {
+		return nil, errors.Wrap(err, "could not derive key")
+	}
+	return derived, nil
+}
+
+// HMAC returns the HMAC-SHA256 of message using key, for authenticating messages with a shared secret.
+func HMAC(message []byte, key *[32]byte) []byte {
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// VerifyHMAC checks in constant time that mac is the HMAC-SHA256 of message using key.
+func VerifyHMAC(message, mac []byte, key *[32]byte) bool {
+	return hmac.Equal(mac, HMAC(message, key))
+}
+
+// Sign returns the Ed25519 signature of message, for authenticating messages with per-node keys.
+func Sign(message []byte, key ed25519.PrivateKey) []byte {
+	return ed25519.Sign(key, message)
+}
+
+// Verify checks that sig is a valid Ed25519 signature of message by key.
+func Verify(message, sig []byte, key ed25519.PublicKey) bool {
+	return len(key) == ed25519.PublicKeySize && ed25519.Verify(key, message, sig)
+}
@@ -0,0 +1,105 @@
+package envelope
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"sync"
+)
+
+// Codec serialises envelopes and their payloads for the wire.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// jsonID identifies the JSON codec. JSON envelopes aren't framed, their opening brace serves as the identifier, so
+// they remain readable on the wire and version 1 envelopes (which were always JSON) are still understood.
+const jsonID = '{'
+
+type codec struct {
+	name string
+	id   byte
+	Codec
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]codec
+	byID   map[byte]codec
+}{byName: make(map[string]codec), byID: make(map[byte]codec)}
+
+func init() {
+	for _, c := range []codec{{"json", jsonID, jsonCodec{}}, {"msgpack", 0x01, msgpackCodec{}}} {
+		codecs.byName[c.name] = c
+		codecs.byID[c.id] = c
+	}
+	send = codecs.byName["json"]
+}
+
+// RegisterCodec makes a codec available under the given name. Every encoded envelope begins with the codec's id byte
+// so receivers can decode any registered codec whichever one they're configured to send.
+func RegisterCodec(name string, id byte, c Codec) error {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, ok := codecs.byName[name]; ok {
+		return errors.Errorf("codec %q is already registered", name)
+	}
+	if _, ok := codecs.byID[id]; ok {
+		return errors.Errorf("codec id %#x is already in use", id)
+	}
+	codecs.byName[name] = codec{name, id, c}
+	codecs.byID[id] = codec{name, id, c}
+	return nil
+}
+
+func codecByName(name string) (codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.byName[name]
+	return c, ok
+}
+
+// frame encodes an envelope with the given codec, prefixing it with the codec's id.
+func frame(c codec, e *Envelope) ([]byte, error) {
+	b, err := c.Marshal(e)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not encode envelope with %v", c.name)
+	}
+	if c.id == jsonID {
+		return b, nil
+	}
+	return append([]byte{c.id}, b...), nil
+}
+
+// unframe identifies the codec of an encoded envelope and decodes it.
+func unframe(data []byte) (codec, *Envelope, error) {
+	if len(data) == 0 {
+		return codec{}, nil, reject("malformed", "empty message")
+	}
+	codecs.RLock()
+	c, ok := codecs.byID[data[0]]
+	codecs.RUnlock()
+	if !ok {
+		return codec{}, nil, reject("unknown-codec", fmt.Sprintf("no codec with id %#x", data[0]))
+	}
+	if c.id != jsonID {
+		data = data[1:]
+	}
+	var e Envelope
+	if err := c.Unmarshal(data, &e); err != nil {
+		return codec{}, nil, reject("malformed", err.Error())
+	}
+	return c, &e, nil
+}
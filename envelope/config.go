@@ -0,0 +1,159 @@
+package envelope
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/crypto"
+	"github.com/alowde/dpoller/logger"
+	"github.com/pkg/errors"
+	"time"
+)
+
+var log *logrus.Entry
+
+// Config describes how messages are authenticated.
+type Config struct {
+	Mode        string            `json:"mode"`         // "none" (default), "hmac" or "ed25519"
+	HMACKey     string            `json:"hmac-key"`     // shared passphrase, for hmac mode
+	KeyID       string            `json:"key-id"`       // name of our own key, for ed25519 mode
+	PrivateKey  string            `json:"private-key"`  // base64 32-byte seed of our own key, for ed25519 mode
+	TrustedKeys map[string]string `json:"trusted-keys"` // key-id to base64 public key, for ed25519 mode
+	MaxAge      int               `json:"max-age"`      // seconds a message remains acceptable after sending
+
+	// EncryptionKeys optionally encrypts every payload. The first key encrypts and all keys decrypt, so keys can be
+	// rotated by adding the new key second on every node, then moving it first, then removing the old key.
+	EncryptionKeys  []EncryptionKey `json:"encryption-keys"`
+	AcceptPlaintext bool            `json:"accept-plaintext"` // accept unencrypted messages, e.g. while rolling out
+
+	// Codec and WireVersion control what we send; every codec and version is always accepted. Version 1 envelopes
+	// are JSON with the full check configuration in each status, and should be sent until every node understands
+	// version 2. Version 0 sends no envelope at all, for clusters that still have nodes that predate it, and can only
+	// be used with authentication and encryption disabled.
+	Codec       string `json:"codec"`        // "json" for version 1, "msgpack" (default), "json" or any registered codec for 2
+	WireVersion int    `json:"wire-version"` // 0, 1 (default) or 2
+}
+
+// EncryptionKey is a named cluster passphrase.
+type EncryptionKey struct {
+	ID         string `json:"id"`
+	Passphrase string `json:"passphrase"`
+}
+
+// keys holds the parsed key material for the configured mode.
+type keys struct {
+	hmac    *[32]byte
+	private ed25519.PrivateKey
+	trusted map[string]ed25519.PublicKey
+	encrypt string               // ID of the key used to encrypt, empty if encryption is disabled
+	decrypt map[string]*[32]byte // stretched keys by ID
+}
+
+// defaults is the configuration used for anything not configured. Version 1 is sent by default so upgraded nodes can
+// always be understood by the rest of the cluster during a rolling upgrade.
+var defaults = Config{Mode: "none", MaxAge: 30, WireVersion: 1}
+
+var conf = defaults
+var k keys
+var send codec
+
+// Initialise parses the security configuration, which may be nil if none was provided.
+func Initialise(config *json.RawMessage, ll logrus.Level) error {
+
+	log = logger.New("envelope", ll)
+
+	if config != nil {
+		if err := json.Unmarshal(*config, &conf); err != nil {
+			return errors.Wrap(err, "could not parse security configuration")
+		}
+	}
+	if conf.MaxAge <= 0 {
+		conf.MaxAge = 30
+	}
+
+	switch conf.Mode {
+	case "", "none":
+		conf.Mode = "none"
+		log.Warn("Message authentication is disabled, any node able to reach the transport can inject messages")
+	case "hmac":
+		var err error
+		if k.hmac, err = crypto.Stretch(conf.HMACKey, []byte("dpoller-hmac")); err != nil {
+			return errors.Wrap(err, "invalid hmac-key")
+		}
+	case "ed25519":
+		if conf.KeyID == "" {
+			return errors.New("missing key-id field")
+		}
+		seed, err := base64.StdEncoding.DecodeString(conf.PrivateKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return errors.New("private-key must be a base64-encoded 32-byte seed")
+		}
+		k.private = ed25519.NewKeyFromSeed(seed)
+		k.trusted = make(map[string]ed25519.PublicKey)
+		for id, pub := range conf.TrustedKeys {
+			b, err := base64.StdEncoding.DecodeString(pub)
+			if err != nil || len(b) != ed25519.PublicKeySize {
+				return errors.Errorf("trusted key %q must be a base64-encoded 32-byte public key", id)
+			}
+			k.trusted[id] = b
+		}
+		// We always trust ourselves, so a node doesn't need to list its own key
+		k.trusted[conf.KeyID] = k.private.Public().(ed25519.PublicKey)
+	default:
+		return errors.Errorf("unknown mode %q, expected none, hmac or ed25519", conf.Mode)
+	}
+	log.WithField("mode", conf.Mode).Debug("Configured message authentication")
+
+	k.decrypt = make(map[string]*[32]byte)
+	for i, ek := range conf.EncryptionKeys {
+		if ek.ID == "" {
+			return errors.Errorf("encryption key %v is missing an id", i)
+		}
+		if _, ok := k.decrypt[ek.ID]; ok {
+			return errors.Errorf("encryption key id %q is used more than once", ek.ID)
+		}
+		key, err := crypto.Stretch(ek.Passphrase, []byte("dpoller-encryption"))
+		if err != nil {
+			return errors.Wrapf(err, "invalid passphrase for encryption key %q", ek.ID)
+		}
+		k.decrypt[ek.ID] = key
+	}
+	if len(conf.EncryptionKeys) > 0 {
+		k.encrypt = conf.EncryptionKeys[0].ID
+		log.WithField("key", k.encrypt).Debug("Configured message encryption")
+	}
+	if len(conf.EncryptionKeys) > 2 {
+		log.Warn("More than two encryption keys configured, old keys should be removed once rotation is complete")
+	}
+
+	switch conf.WireVersion {
+	case 0:
+		if conf.Mode != "none" || k.encrypt != "" {
+			return errors.New("wire-version 0 can't be authenticated or encrypted, mode must be none without " +
+				"encryption-keys")
+		}
+		log.Warn("Sending messages without an envelope, set wire-version 1 once every node understands it")
+		conf.Codec = "json"
+	case 1:
+		conf.Codec = "json"
+	case Version:
+		if conf.Codec == "" {
+			conf.Codec = "msgpack"
+		}
+	default:
+		return errors.Errorf("unknown wire-version %v, expected 0, 1 or %v", conf.WireVersion, Version)
+	}
+	var ok bool
+	if send, ok = codecByName(conf.Codec); !ok {
+		return errors.Errorf("unknown codec %q", conf.Codec)
+	}
+	log.WithFields(logrus.Fields{"codec": send.name, "version": conf.WireVersion}).Debug("Configured message encoding")
+	return nil
+}
+
+// MaxAge returns the age beyond which a message is rejected. Transports that replay history open it with OpenReplayed
+// instead.
+func MaxAge() time.Duration {
+	return time.Duration(conf.MaxAge) * time.Second
+}
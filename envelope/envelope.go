@@ -0,0 +1,438 @@
+// Package envelope wraps the messages exchanged between nodes so they can be encoded, authenticated and encrypted the
+// same way whichever transport carries them. Publishers Seal a status or heartbeat before sending it and listeners Open
+// what they receive, dropping anything that isn't authentic, can't be decrypted, is too old, or has been seen before.
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/crypto"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/publish"
+	"github.com/alowde/dpoller/url"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// Version is the newest envelope format understood. Version 1 envelopes predate the version field and are always JSON,
+// and version 0 is the bare JSON sent by nodes that predate the envelope, see legacy.
+const Version = 2
+
+// Envelope carries a serialised status or heartbeat along with the information needed to authenticate it. The payload
+// is serialised with the same codec as the envelope itself.
+type Envelope struct {
+	Version   int             `json:"version,omitempty" msgpack:"v,omitempty"`
+	Type      string          `json:"type" msgpack:"t"`                            // "status" or "heartbeat"
+	Sender    int64           `json:"sender" msgpack:"s"`                          // ID of the sending node
+	Timestamp time.Time       `json:"timestamp" msgpack:"ts"`                      // time the envelope was sealed
+	Nonce     string          `json:"nonce" msgpack:"n"`                           // random value, rejected if seen twice
+	KeyID     string          `json:"key-id,omitempty" msgpack:"k,omitempty"`      // identifies the Ed25519 signing key
+	Signature []byte          `json:"signature,omitempty" msgpack:"sig,omitempty"` // signature over everything else
+	Payload   json.RawMessage `json:"payload,omitempty" msgpack:"p,omitempty"`     // the message, if not encrypted
+
+	// Encrypted messages carry a ciphertext in place of the payload, along with the ID of the cluster key and the
+	// random salt used to derive this message's key from it.
+	EncKeyID   string `json:"enc-key-id,omitempty" msgpack:"ek,omitempty"`
+	Salt       []byte `json:"salt,omitempty" msgpack:"salt,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty" msgpack:"c,omitempty"`
+}
+
+// status is the version 2 form of a check.Status. Every node is configured with the same checks, so rather than
+// carrying the whole check each status names it, along with a hash to detect configurations that have drifted apart.
+type status struct {
+	Node       node.Node `json:"node" msgpack:"n"`
+	Check      string    `json:"check" msgpack:"c"`
+	CheckHash  string    `json:"check-hash" msgpack:"h"`
+	Rtime      int       `json:"rtime" msgpack:"r"`
+	StatusCode int       `json:"status-code" msgpack:"sc"`
+	StatusTxt  string    `json:"status-txt" msgpack:"st"`
+	Timestamp  int       `json:"timestamp" msgpack:"ts"`
+}
+
+func slim(s check.Status) status {
+	return status{s.Node, s.Url.Name, s.Url.Hash(), s.Rtime, s.StatusCode, s.StatusTxt, s.Timestamp}
+}
+
+// drifted remembers which check hashes have already been warned about, so drift is reported once rather than on
+// every status.
+var drifted = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+// expand restores a check.Status using our own configuration for the named check.
+func (s status) expand() (check.Status, error) {
+	c, err := url.Checks.ByName(s.Check)
+	if err != nil {
+		return check.Status{}, reject("unknown-check", fmt.Sprintf("check %q is not configured", s.Check))
+	}
+	if h := c.Hash(); h != s.CheckHash {
+		drifted.Lock()
+		if !drifted.seen[s.Check+s.CheckHash] {
+			drifted.seen[s.Check+s.CheckHash] = true
+			log.WithFields(logrus.Fields{"check": s.Check, "node": s.Node.ID}).
+				Warn("Check configuration differs from another node's, using our own")
+		}
+		drifted.Unlock()
+	}
+	return check.Status{
+		Node:       s.Node,
+		Url:        c,
+		Rtime:      s.Rtime,
+		StatusCode: s.StatusCode,
+		StatusTxt:  s.StatusTxt,
+		Timestamp:  s.Timestamp,
+	}, nil
+}
+
+// Rejected counts messages dropped by Open, by reason.
+var Rejected = expvar.NewMap("envelope_rejected")
+
+// Rejection is returned by Open when a message is dropped. Reason is a short machine-friendly description.
+type Rejection struct {
+	Reason string
+	Detail string
+}
+
+func (r Rejection) Error() string {
+	return fmt.Sprintf("message rejected (%v): %v", r.Reason, r.Detail)
+}
+
+// Duplicate reports whether a message was rejected only because it had already been opened. That's expected when
+// messages are sent over several redundant transports, so the copy can be dropped quietly.
+func Duplicate(err error) bool {
+	r, ok := err.(Rejection)
+	return ok && r.Reason == "replay"
+}
+
+// Stale reports whether a message was rejected only because it was sealed too long ago. Messages a transport holds on
+// to, such as retained or replayed messages, may be expected to be stale and can be dropped quietly.
+func Stale(err error) bool {
+	r, ok := err.(Rejection)
+	return ok && r.Reason == "stale"
+}
+
+func reject(reason, detail string) error {
+	Rejected.Add(reason, 1)
+	return Rejection{reason, detail}
+}
+
+// signedBytes returns the canonical representation of everything the signature covers.
+func (e *Envelope) signedBytes() []byte {
+	var b bytes.Buffer
+	// Version 1 envelopes had no version, for later versions it's covered so it can't be stripped to force a downgrade
+	if e.Version > 1 {
+		fmt.Fprintf(&b, "v%v\n", e.Version)
+	}
+	fmt.Fprintf(&b, "%v\n%v\n%v\n%v\n%v\n", e.Type, e.Sender, e.Timestamp.UnixNano(), e.Nonce, e.KeyID)
+	b.Write(e.Payload)
+	// Encrypted messages are signed after encryption, so a forgery is rejected without attempting to decrypt it
+	if len(e.Ciphertext) > 0 {
+		fmt.Fprintf(&b, "\n%v\n%x\n", e.EncKeyID, e.Salt)
+		b.Write(e.Ciphertext)
+	}
+	return b.Bytes()
+}
+
+// header returns the canonical representation of the envelope's header. It's bound to the ciphertext of an encrypted
+// envelope as additional data, so even without a signature a ciphertext can't be moved into a fresh envelope to get
+// past the age and replay checks.
+func (e *Envelope) header() []byte {
+	return []byte(fmt.Sprintf("v%v\n%v\n%v\n%v\n%v\n%v\n%v\n%x\n", e.Version, e.Type, e.Sender,
+		e.Timestamp.UnixNano(), e.Nonce, e.KeyID, e.EncKeyID, e.Salt))
+}
+
+// encrypt replaces the payload with a ciphertext under a key derived from the current cluster key and a random salt.
+// The header must be complete beforehand, see header.
+func (e *Envelope) encrypt() error {
+	e.EncKeyID = k.encrypt
+	e.Salt = make([]byte, 16)
+	if _, err := rand.Read(e.Salt); err != nil {
+		return errors.Wrap(err, "could not generate salt")
+	}
+	key, err := crypto.Derive(k.decrypt[e.EncKeyID], e.Salt)
+	if err != nil {
+		return err
+	}
+	if e.Ciphertext, err = crypto.EncryptWithData(e.Payload, e.header(), key); err != nil {
+		return errors.Wrap(err, "could not encrypt message")
+	}
+	e.Payload = nil
+	return nil
+}
+
+// decrypt restores the payload of an encrypted envelope.
+func (e *Envelope) decrypt() error {
+	if len(e.Ciphertext) == 0 {
+		if k.encrypt != "" && !conf.AcceptPlaintext {
+			return reject("unencrypted", "message is not encrypted")
+		}
+		return nil
+	}
+	cluster, ok := k.decrypt[e.EncKeyID]
+	if !ok {
+		return reject("unknown-encryption-key", fmt.Sprintf("encryption key %q is not configured", e.EncKeyID))
+	}
+	key, err := crypto.Derive(cluster, e.Salt)
+	if err != nil {
+		return reject("undecryptable", err.Error())
+	}
+	if e.Payload, err = crypto.DecryptWithData(e.Ciphertext, e.header(), key); err != nil {
+		return reject("undecryptable", err.Error())
+	}
+	return nil
+}
+
+// Seal serialises a check.Status or heartbeat.Beat into a signed envelope ready for transmission, using the configured
+// codec and wire version.
+func Seal(i interface{}) ([]byte, error) {
+	e := Envelope{
+		Sender:    node.Self.ID,
+		Timestamp: time.Now(),
+	}
+	if conf.WireVersion > 1 {
+		e.Version = conf.WireVersion
+	}
+	if conf.WireVersion == 0 {
+		switch i.(type) {
+		case check.Status, heartbeat.Beat:
+			return json.Marshal(i)
+		}
+		return nil, errors.New("unknown type of message")
+	}
+	payload := i
+	switch m := i.(type) {
+	case check.Status:
+		e.Type = "status"
+		if e.Version > 1 {
+			payload = slim(m)
+		}
+	case heartbeat.Beat:
+		e.Type = "heartbeat"
+	default:
+		return nil, errors.New("unknown type of message")
+	}
+	return e.seal(payload)
+}
+
+func init() {
+	publish.RegisterSealFunction(Seal)
+}
+
+// seal serialises the payload into the envelope, then encrypts, signs and encodes it.
+func (e *Envelope) seal(payload interface{}) ([]byte, error) {
+	var err error
+	if e.Payload, err = send.Marshal(payload); err != nil {
+		return nil, errors.Wrap(err, "could not serialise message")
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "could not generate nonce")
+	}
+	e.Nonce = hex.EncodeToString(nonce)
+	if conf.Mode == "ed25519" {
+		e.KeyID = conf.KeyID
+	}
+
+	if k.encrypt != "" {
+		if err := e.encrypt(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch conf.Mode {
+	case "hmac":
+		e.Signature = crypto.HMAC(e.signedBytes(), k.hmac)
+	case "ed25519":
+		e.Signature = crypto.Sign(e.signedBytes(), k.private)
+	}
+	return frame(send, e)
+}
+
+// Open authenticates a received envelope of any known codec and version and returns the check.Status or
+// heartbeat.Beat inside it. Any error returned is a Rejection and the message should be dropped.
+func Open(data []byte) (interface{}, error) {
+	return open(data, MaxAge(), false, "")
+}
+
+// OpenTyped is Open for transports that carry the type of each message alongside it, e.g. in an AMQP header. The type
+// is only needed to decode messages from nodes that predate the envelope.
+func OpenTyped(data []byte, msgType string) (interface{}, error) {
+	return open(data, MaxAge(), false, msgType)
+}
+
+// OpenWill is Open for transports that deliver a last will on a node's behalf. An obituary used as a last will is
+// sealed when its node connects but delivered whenever the connection is lost, so it's exempt from the age check.
+// Instead a will is only accepted if it was sealed after any will already opened from the same sender, so each counts
+// once however long ago it was sealed, see admitWill. Only use OpenWill for messages the transport is delivering as
+// they happen, never for history it's retained or replayed: those obituaries may be from long-departed nodes.
+func OpenWill(data []byte) (interface{}, error) {
+	return open(data, MaxAge(), true, "")
+}
+
+// OpenReplayed is Open for statuses a transport replays from its history when a node starts, which may be up to within
+// old rather than the usual age limit. Only use it for history that was recorded before the node started, so nothing
+// injected later can take advantage of the longer limit.
+func OpenReplayed(data []byte, within time.Duration) (interface{}, error) {
+	return open(data, within, false, "")
+}
+
+func open(data []byte, maxAge time.Duration, will bool, msgType string) (interface{}, error) {
+	if bare(data) {
+		return legacy(data, msgType, maxAge)
+	}
+	c, e, err := unseal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	switch e.Type {
+	case "status":
+		var s check.Status
+		if e.Version <= 1 {
+			if err := c.Unmarshal(e.Payload, &s); err != nil {
+				return nil, reject("malformed", err.Error())
+			}
+		} else {
+			var slim status
+			if err := c.Unmarshal(e.Payload, &slim); err != nil {
+				return nil, reject("malformed", err.Error())
+			}
+			if s, err = slim.expand(); err != nil {
+				return nil, err
+			}
+		}
+		if s.Node.ID != e.Sender {
+			return nil, reject("sender-mismatch", fmt.Sprintf("status from %v sent by %v", s.Node.ID, e.Sender))
+		}
+		v = s
+	case "heartbeat":
+		var b heartbeat.Beat
+		if err := c.Unmarshal(e.Payload, &b); err != nil {
+			return nil, reject("malformed", err.Error())
+		}
+		if b.ID != e.Sender {
+			return nil, reject("sender-mismatch", fmt.Sprintf("heartbeat from %v sent by %v", b.ID, e.Sender))
+		}
+		v = b
+		if will && b.IsObituary() {
+			return v, e.admitWill()
+		}
+	default:
+		return nil, reject("malformed", fmt.Sprintf("unknown message type %q", e.Type))
+	}
+
+	return v, e.admit(maxAge)
+}
+
+// unseal decodes, authenticates and decrypts an envelope of any known codec and version.
+func unseal(data []byte) (codec, *Envelope, error) {
+	c, e, err := unframe(data)
+	if err != nil {
+		return c, nil, err
+	}
+	if e.Version > Version {
+		return c, nil, reject("unsupported-version", fmt.Sprintf("envelope version %v is newer than %v", e.Version,
+			Version))
+	}
+	if e.Version <= 1 && c.id != jsonID {
+		return c, nil, reject("malformed", fmt.Sprintf("version 1 envelope encoded with %v", c.name))
+	}
+	if err := verify(e); err != nil {
+		return c, nil, err
+	}
+	if err := e.decrypt(); err != nil {
+		return c, nil, err
+	}
+	return c, e, nil
+}
+
+// admit rejects an authentic envelope that's older than maxAge or has been seen before.
+func (e *Envelope) admit(maxAge time.Duration) error {
+	if age := time.Since(e.Timestamp); age > maxAge || age < -MaxAge() {
+		return reject("stale", fmt.Sprintf("message sealed %v ago", age))
+	}
+	return replayed(e)
+}
+
+// verify checks the envelope's signature according to the configured mode.
+func verify(e *Envelope) error {
+	switch conf.Mode {
+	case "hmac":
+		if len(e.Signature) == 0 {
+			return reject("unsigned", "message has no signature")
+		}
+		if !crypto.VerifyHMAC(e.signedBytes(), e.Signature, k.hmac) {
+			return reject("bad-signature", "HMAC does not match")
+		}
+	case "ed25519":
+		if len(e.Signature) == 0 {
+			return reject("unsigned", "message has no signature")
+		}
+		pub, ok := k.trusted[e.KeyID]
+		if !ok {
+			return reject("unknown-key", fmt.Sprintf("key %q is not trusted", e.KeyID))
+		}
+		if !crypto.Verify(e.signedBytes(), e.Signature, pub) {
+			return reject("bad-signature", fmt.Sprintf("signature does not match key %q", e.KeyID))
+		}
+	}
+	return nil
+}
+
+// wills remembers when the latest last will opened from each sender was sealed. Node IDs change on every start, so
+// there's one entry per node start, which is small enough to keep for good.
+var wills = struct {
+	sync.Mutex
+	latest map[int64]time.Time
+}{latest: make(map[int64]time.Time)}
+
+// admitWill rejects a last will unless it was sealed after any other will from its sender. Nonces are only remembered
+// for as long as a message would pass the age check, which wills are exempt from, so a will captured from a node's
+// connection could otherwise be replayed to evict the node once its nonce had been forgotten.
+func (e *Envelope) admitWill() error {
+	wills.Lock()
+	defer wills.Unlock()
+	if last, ok := wills.latest[e.Sender]; ok && !e.Timestamp.After(last) {
+		return reject("replay", fmt.Sprintf("will sealed at %v, already seen one sealed at %v", e.Timestamp, last))
+	}
+	wills.latest[e.Sender] = e.Timestamp
+	return nil
+}
+
+// nonces remembers the nonces of recently opened envelopes. Entries only need to be kept for as long as an envelope
+// would pass the age check.
+var nonces = struct {
+	sync.Mutex
+	seen  map[string]time.Time
+	swept time.Time
+}{seen: make(map[string]time.Time)}
+
+// replayed records the envelope's nonce and returns a Rejection if it's been seen before. The nonce identifies the
+// message, so as well as stopping replays this drops copies of a message that arrive over more than one transport.
+func replayed(e *Envelope) error {
+	nonces.Lock()
+	defer nonces.Unlock()
+	if time.Since(nonces.swept) > MaxAge() {
+		for n, t := range nonces.seen {
+			if time.Since(t) > 2*MaxAge() {
+				delete(nonces.seen, n)
+			}
+		}
+		nonces.swept = time.Now()
+	}
+	if _, ok := nonces.seen[e.Nonce]; ok {
+		return reject("replay", fmt.Sprintf("nonce %v already seen", e.Nonce))
+	}
+	nonces.seen[e.Nonce] = time.Now()
+	return nil
+}
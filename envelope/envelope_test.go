@@ -0,0 +1,380 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/url"
+	"github.com/alowde/dpoller/url/check"
+	"net"
+	"testing"
+	"time"
+)
+
+var node1 = node.Node{
+	ID:   1000000000000000000,
+	EIP:  net.IP{10, 0, 0, 1},
+	Name: "test_node_1",
+}
+
+var check1 = check.Check{
+	URL:      "http://example.com",
+	Name:     "example",
+	OkStatus: []int{200},
+}
+
+var seed1 = base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize))
+
+// configure resets the package to the given security configuration.
+func configure(t *testing.T, c string) {
+	conf = defaults
+	k = keys{}
+	raw := json.RawMessage(c)
+	if err := Initialise(&raw, logrus.FatalLevel); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	node.Self = node1
+	url.Checks = check.Checks{check1}
+	tables := []struct {
+		description string
+		config      string
+	}{
+		{"no authentication", `{"mode": "none"}`},
+		{"shared key", `{"mode": "hmac", "hmac-key": "correct horse battery staple"}`},
+		{"per-node key", `{"mode": "ed25519", "key-id": "node1", "private-key": "` + seed1 + `"}`},
+		{"version 2", `{"mode": "hmac", "hmac-key": "correct horse battery staple", "wire-version": 2}`},
+		{"version 2 json", `{"mode": "hmac", "hmac-key": "correct horse battery staple", "wire-version": 2, ` +
+			`"codec": "json"}`},
+		{"no envelope", `{"wire-version": 0}`},
+	}
+	for _, table := range tables {
+		configure(t, table.config)
+		for _, msg := range []interface{}{
+			check.Status{Node: node1, Url: check1, StatusCode: 200, Timestamp: int(time.Now().Unix())},
+			heartbeat.Beat{Node: node1, Coordinator: true, Timestamp: time.Now()},
+		} {
+			data, err := Seal(msg)
+			if err != nil {
+				t.Fatalf("Error in Seal() for case %q: %v", table.description, err)
+			}
+			v, err := Open(data)
+			if err != nil {
+				t.Errorf("Error in Open() for case %q: %v", table.description, err)
+				continue
+			}
+			switch m := v.(type) {
+			case check.Status:
+				if m.StatusCode != 200 || m.Url.URL != check1.URL {
+					t.Errorf("Error in Open() for case %q, status was %+v", table.description, m)
+				}
+			case heartbeat.Beat:
+				if !m.Coordinator {
+					t.Errorf("Error in Open() for case %q, coordinator flag was lost", table.description)
+				}
+			}
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	node.Self = node1
+	beat := heartbeat.Beat{Node: node1, Timestamp: time.Now()}
+
+	configure(t, `{"mode": "none"}`)
+	unsigned, _ := Seal(beat)
+
+	configure(t, `{"mode": "hmac", "hmac-key": "a different passphrase"}`)
+	otherKey, _ := Seal(beat)
+
+	configure(t, `{"mode": "hmac", "hmac-key": "correct horse battery staple", "codec": "json"}`)
+	good, _ := Seal(beat)
+	c, e, _ := unframe(good)
+	e.Payload, _ = c.Marshal(heartbeat.Beat{Node: node1, Coordinator: true, Timestamp: time.Now()})
+	tampered, _ := frame(c, e)
+	e.Version = 0
+	downgraded, _ := frame(c, e)
+
+	node.Self.ID = 42
+	impostor, _ := Seal(beat)
+	node.Self = node1
+
+	tables := []struct {
+		description string
+		data        []byte
+		reason      string
+	}{
+		{"garbage", []byte("{not an envelope"), "malformed"},
+		{"unsigned", unsigned, "unsigned"},
+		{"wrong key", otherKey, "bad-signature"},
+		{"tampered payload", tampered, "bad-signature"},
+		{"version stripped", downgraded, "bad-signature"},
+		{"sender doesn't match payload", impostor, "sender-mismatch"},
+	}
+	for _, table := range tables {
+		_, err := Open(table.data)
+		if r, ok := err.(Rejection); !ok || r.Reason != table.reason {
+			t.Errorf("Error in Open() for case %q, expected rejection %q, got %v", table.description, table.reason, err)
+		}
+	}
+
+	if _, err := Open(good); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	if _, err := Open(good); err == nil || err.(Rejection).Reason != "replay" {
+		t.Errorf("Error in Open(), expected replayed message to be rejected, got %v", err)
+	}
+}
+
+func TestStale(t *testing.T) {
+	node.Self = node1
+	configure(t, `{"mode": "hmac", "hmac-key": "correct horse battery staple", "max-age": 1}`)
+
+	url.Checks = check.Checks{check1}
+	old, _ := Seal(heartbeat.Beat{Node: node1, Timestamp: time.Now()})
+	obituary, _ := Seal(heartbeat.NewObituary())
+	history, _ := Seal(check.Status{Node: node1, Url: check1, StatusCode: 200})
+	time.Sleep(1100 * time.Millisecond)
+
+	if _, err := OpenReplayed(history, time.Minute); err != nil {
+		t.Errorf("Error in OpenReplayed(), expected a replayed status within the horizon, got %v", err)
+	}
+	if _, err := OpenReplayed(old, time.Second); !Stale(err) {
+		t.Errorf("Error in OpenReplayed(), expected a message beyond the horizon to be stale, got %v", err)
+	}
+
+	if _, err := Open(old); err == nil || err.(Rejection).Reason != "stale" {
+		t.Errorf("Error in Open(), expected stale message to be rejected, got %v", err)
+	}
+	if _, err := Open(obituary); !Stale(err) {
+		t.Errorf("Error in Open(), expected an obituary that isn't a last will to be stale, got %v", err)
+	}
+	if _, err := OpenWill(old); !Stale(err) {
+		t.Errorf("Error in OpenWill(), expected stale heartbeat to be rejected, got %v", err)
+	}
+	if _, err := OpenWill(obituary); err != nil {
+		t.Errorf("Error in OpenWill(), expected late last will to be accepted, got %v", err)
+	}
+}
+
+func TestWill(t *testing.T) {
+	node.Self = node1
+	configure(t, `{"mode": "hmac", "hmac-key": "correct horse battery staple"}`)
+
+	first, _ := Seal(heartbeat.NewObituary())
+	second, _ := Seal(heartbeat.NewObituary()) // sealed for a later connection
+	if _, err := OpenWill(first); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+
+	// Once its nonce has been forgotten a captured will still can't be replayed, nor can an older one
+	nonces.Lock()
+	nonces.seen = make(map[string]time.Time)
+	nonces.Unlock()
+	if _, err := OpenWill(first); !Duplicate(err) {
+		t.Errorf("Error in OpenWill(), expected a replayed will to be rejected, got %v", err)
+	}
+	if _, err := OpenWill(second); err != nil {
+		t.Errorf("Error in OpenWill(), expected a later will to be accepted, got %v", err)
+	}
+	if _, err := OpenWill(first); !Duplicate(err) {
+		t.Errorf("Error in OpenWill(), expected an earlier will to be rejected, got %v", err)
+	}
+}
+
+func TestUntrustedKey(t *testing.T) {
+	node.Self = node1
+	configure(t, `{"mode": "ed25519", "key-id": "intruder", "private-key": "`+seed1+`"}`)
+	data, _ := Seal(heartbeat.Beat{Node: node1, Timestamp: time.Now()})
+
+	seed2 := base64.StdEncoding.EncodeToString([]byte("01234567890123456789012345678901"))
+	configure(t, `{"mode": "ed25519", "key-id": "node2", "private-key": "`+seed2+`"}`)
+	if _, err := Open(data); err == nil || err.(Rejection).Reason != "unknown-key" {
+		t.Errorf("Error in Open(), expected untrusted key to be rejected, got %v", err)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	node.Self = node1
+	beat := heartbeat.Beat{Node: node1, Timestamp: time.Now()}
+
+	configure(t, `{"mode": "none"}`)
+	plaintext, _ := Seal(beat)
+
+	configure(t, `{"encryption-keys": [{"id": "old", "passphrase": "the old cluster passphrase"}]}`)
+	oldKey, _ := Seal(beat)
+
+	// Mid-rotation: encrypting with the new key, still able to decrypt with the old one
+	configure(t, `{"encryption-keys": [{"id": "new", "passphrase": "the new cluster passphrase"},
+		{"id": "old", "passphrase": "the old cluster passphrase"}]}`)
+	newKey, _ := Seal(beat)
+	_, e, _ := unframe(newKey)
+	if len(e.Payload) != 0 || e.EncKeyID != "new" {
+		t.Fatalf("Error in Seal(), expected payload encrypted with new key, got %+v", e)
+	}
+	for _, data := range [][]byte{oldKey, newKey} {
+		if _, err := Open(data); err != nil {
+			t.Errorf("Error in Open(), expected message to decrypt during rotation, got %v", err)
+		}
+	}
+	if _, err := Open(plaintext); err == nil || err.(Rejection).Reason != "unencrypted" {
+		t.Errorf("Error in Open(), expected plaintext to be rejected, got %v", err)
+	}
+
+	// Rotation complete: the old key is no longer accepted
+	configure(t, `{"encryption-keys": [{"id": "new", "passphrase": "the new cluster passphrase"}],
+		"accept-plaintext": true}`)
+	if _, err := Open(oldKey); err == nil || err.(Rejection).Reason != "unknown-encryption-key" {
+		t.Errorf("Error in Open(), expected retired key to be rejected, got %v", err)
+	}
+	if _, err := Open(plaintext); err != nil {
+		t.Errorf("Error in Open(), expected plaintext to be accepted, got %v", err)
+	}
+
+	// Without a signature the header is still bound to the ciphertext, so an old ciphertext can't be given a fresh one
+	old, _ := Seal(beat)
+	c, e, _ := unframe(old)
+	e.Timestamp, e.Nonce = time.Now().Add(time.Second), "fresh"
+	moved, _ := frame(c, e)
+	if _, err := Open(moved); err == nil || err.(Rejection).Reason != "undecryptable" {
+		t.Errorf("Error in Open(), expected a ciphertext in a new header to be rejected, got %v", err)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	node.Self = node1
+	url.Checks = check.Checks{check1}
+	status := check.Status{Node: node1, Url: check1, StatusCode: 200}
+
+	configure(t, `{}`)
+	v1, _ := Seal(status)
+	if v1[0] != jsonID || bytes.Contains(v1, []byte(`"version"`)) {
+		t.Errorf("Error in Seal(), expected a version 1 JSON envelope by default, got %s", v1)
+	}
+	configure(t, `{"wire-version": 2, "codec": "json"}`)
+	v2json, _ := Seal(status)
+	unknown, _ := Seal(check.Status{Node: node1, Url: check.Check{Name: "unknown"}, StatusCode: 200})
+	c, e, _ := unframe(v2json)
+	e.Version = Version + 1
+	future, _ := frame(c, e)
+	configure(t, `{"wire-version": 2}`)
+	v2msgpack, _ := Seal(status)
+
+	if len(v2msgpack) >= len(v1) {
+		t.Errorf("Error in Seal(), expected version 2 to be smaller than version 1, got %v and %v bytes",
+			len(v2msgpack), len(v1))
+	}
+	// A node sending one codec and version must accept all of them
+	for _, data := range [][]byte{v1, v2json, v2msgpack} {
+		v, err := Open(data)
+		if err != nil {
+			t.Errorf("Error in Open(), expected message to be accepted, got %v", err)
+			continue
+		}
+		if s := v.(check.Status); s.Url.URL != check1.URL || s.StatusCode != 200 {
+			t.Errorf("Error in Open(), status was %+v", s)
+		}
+	}
+
+	tables := []struct {
+		description string
+		data        []byte
+		reason      string
+	}{
+		{"unconfigured check", unknown, "unknown-check"},
+		{"future version", future, "unsupported-version"},
+		{"unknown codec", []byte{0x7f, 0x00}, "unknown-codec"},
+	}
+	for _, table := range tables {
+		_, err := Open(table.data)
+		if r, ok := err.(Rejection); !ok || r.Reason != table.reason {
+			t.Errorf("Error in Open() for case %q, expected rejection %q, got %v", table.description, table.reason, err)
+		}
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	node.Self = node1
+	configure(t, `{"mode": "none"}`)
+	data, _ := Seal(heartbeat.Beat{Node: node1, Timestamp: time.Now()})
+
+	if _, err := Open(data); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	// The same message received over a second transport
+	if _, err := Open(data); !Duplicate(err) {
+		t.Errorf("Error in Open(), expected a duplicate, got %v", err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	node.Self = node1
+	configure(t, `{"mode": "hmac", "hmac-key": "correct horse battery staple"}`)
+
+	data, err := SealMessage("members", []string{"10.0.0.2:7946"})
+	if err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	var wrong []string
+	if err := OpenMessage(data, "peers", &wrong); err == nil {
+		t.Errorf("Error in OpenMessage(), expected a message of another type to be rejected")
+	}
+	if _, err := Open(data); err == nil {
+		t.Errorf("Error in Open(), expected a message that isn't a status or heartbeat to be rejected")
+	}
+	var addrs []string
+	if err := OpenMessage(data, "members", &addrs); err != nil || len(addrs) != 1 {
+		t.Errorf("Error in OpenMessage(), expected the sealed list, got %v and %v", addrs, err)
+	}
+	if _, err := SealMessage("status", nil); err == nil {
+		t.Errorf("Error in SealMessage(), expected the status type to be reserved")
+	}
+}
+
+// TestLegacy feeds messages in the format sent by nodes that predate the envelope through Open.
+func TestLegacy(t *testing.T) {
+	node.Self = node1
+	url.Checks = check.Checks{check1}
+	status, _ := json.Marshal(check.Status{Node: node1, Url: check1, StatusCode: 200, Timestamp: int(time.Now().Unix())})
+	beat, _ := json.Marshal(heartbeat.Beat{Node: node1, Timestamp: time.Now()})
+	old, _ := json.Marshal(heartbeat.Beat{Node: node1, Timestamp: time.Now().Add(-time.Hour)})
+
+	configure(t, `{}`)
+	if v, err := OpenTyped(status, "status"); err != nil || v.(check.Status).StatusCode != 200 {
+		t.Errorf("Error in OpenTyped(), expected a bare status to be accepted, got %v and %v", v, err)
+	}
+	if v, err := OpenTyped(beat, "heartbeat"); err != nil || v.(heartbeat.Beat).ID != node1.ID {
+		t.Errorf("Error in OpenTyped(), expected a bare heartbeat to be accepted, got %v and %v", v, err)
+	}
+	// Transports without a type header rely on the fields present
+	if v, err := Open(status); err != nil {
+		t.Errorf("Error in Open(), expected a bare status to be accepted, got %v", err)
+	} else if _, ok := v.(check.Status); !ok {
+		t.Errorf("Error in Open(), expected a bare status to be decoded as a status, got %T", v)
+	}
+	if v, err := Open(beat); err != nil {
+		t.Errorf("Error in Open(), expected a bare heartbeat to be accepted, got %v", err)
+	} else if _, ok := v.(heartbeat.Beat); !ok {
+		t.Errorf("Error in Open(), expected a bare heartbeat to be decoded as a heartbeat, got %T", v)
+	}
+	if _, err := OpenTyped(old, "heartbeat"); !Stale(err) {
+		t.Errorf("Error in OpenTyped(), expected an old bare heartbeat to be stale, got %v", err)
+	}
+
+	// Bare messages can't be authenticated
+	configure(t, `{"mode": "hmac", "hmac-key": "correct horse battery staple"}`)
+	if _, err := OpenTyped(beat, "heartbeat"); err == nil || err.(Rejection).Reason != "unsigned" {
+		t.Errorf("Error in OpenTyped(), expected a bare heartbeat to be rejected, got %v", err)
+	}
+	conf = defaults
+	raw := json.RawMessage(`{"mode": "hmac", "hmac-key": "correct horse battery staple", "wire-version": 0}`)
+	if err := Initialise(&raw, logrus.FatalLevel); err == nil {
+		t.Errorf("Error in Initialise(), expected wire-version 0 to be refused with authentication")
+	}
+}
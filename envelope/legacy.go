@@ -0,0 +1,72 @@
+package envelope
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"time"
+)
+
+// Nodes that predate the envelope send statuses and heartbeats as bare JSON and rely on the transport to say which is
+// which. They're understood so a cluster can be upgraded a node at a time, and wire-version 0 sends the same format so
+// they can understand us. Bare messages can't be authenticated, so they're only accepted while authentication is
+// disabled and unencrypted messages are acceptable.
+
+// bare reports whether data is a JSON message without an envelope.
+func bare(data []byte) bool {
+	if len(data) == 0 || data[0] != jsonID {
+		return false
+	}
+	var e struct {
+		Type  string `json:"type"`
+		Nonce string `json:"nonce"`
+	}
+	return json.Unmarshal(data, &e) == nil && e.Type == "" && e.Nonce == ""
+}
+
+// legacy decodes a bare message. The type is taken from the transport where it has one, otherwise it's inferred from
+// the fields present.
+func legacy(data []byte, msgType string, maxAge time.Duration) (interface{}, error) {
+	if conf.Mode != "none" {
+		return nil, reject("unsigned", "message has no envelope")
+	}
+	if k.encrypt != "" && !conf.AcceptPlaintext {
+		return nil, reject("unencrypted", "message has no envelope")
+	}
+	if msgType == "" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, reject("malformed", err.Error())
+		}
+		if _, ok := fields["Url"]; ok {
+			msgType = "status"
+		} else if _, ok := fields["ID"]; ok {
+			msgType = "heartbeat"
+		}
+	}
+
+	var v interface{}
+	var sealed time.Time
+	switch msgType {
+	case "status":
+		var s check.Status
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, reject("malformed", err.Error())
+		}
+		v, sealed = s, time.Unix(int64(s.Timestamp), 0)
+	case "heartbeat":
+		var b heartbeat.Beat
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, reject("malformed", err.Error())
+		}
+		v, sealed = b, b.Timestamp
+	default:
+		return nil, reject("malformed", fmt.Sprintf("unknown message type %q", msgType))
+	}
+	// There's no nonce to drop duplicates by, but old messages are still refused
+	if age := time.Since(sealed); age > maxAge || age < -MaxAge() {
+		return nil, reject("stale", fmt.Sprintf("message sent %v ago", age))
+	}
+	return v, nil
+}
@@ -0,0 +1,43 @@
+package envelope
+
+import (
+	"fmt"
+	"github.com/alowde/dpoller/node"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// SealMessage seals a message other than a status or heartbeat, such as a transport's own control messages, so it's
+// authenticated and encrypted the same way. The type distinguishes it from other messages and must be given again to
+// OpenMessage. Open rejects these messages, so they can't be mistaken for a status or heartbeat.
+func SealMessage(msgType string, v interface{}) ([]byte, error) {
+	switch msgType {
+	case "", "status", "heartbeat":
+		return nil, errors.Errorf("invalid message type %q", msgType)
+	}
+	e := Envelope{
+		Type:      msgType,
+		Sender:    node.Self.ID,
+		Timestamp: time.Now(),
+	}
+	if conf.WireVersion > 1 {
+		e.Version = conf.WireVersion
+	}
+	return e.seal(v)
+}
+
+// OpenMessage authenticates an envelope sealed by SealMessage with the same type and decodes its payload into v. Any
+// error returned is a Rejection and the message should be dropped.
+func OpenMessage(data []byte, msgType string, v interface{}) error {
+	c, e, err := unseal(data)
+	if err != nil {
+		return err
+	}
+	if e.Type != msgType {
+		return reject("malformed", fmt.Sprintf("expected a %q message, got %q", msgType, e.Type))
+	}
+	if err := c.Unmarshal(e.Payload, v); err != nil {
+		return reject("malformed", err.Error())
+	}
+	return e.admit(MaxAge())
+}
@@ -0,0 +1,118 @@
+// Package gossip implements a brokerless transport. Nodes exchange statuses and heartbeats directly over HTTP, and
+// periodically swap authenticated membership lists with a random peer, starting with the seeds, so the cluster
+// converges on a shared view without any external infrastructure.
+// The package registers as both a listener and a publisher. The listener configuration starts the HTTP server and must
+// be present; the publisher configuration may repeat it or be empty.
+package gossip
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/listen"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/publish"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+)
+
+var log *logrus.Entry
+
+// Config describes how this node takes part in the gossip cluster.
+type Config struct {
+	Bind         string   `json:"bind"`          // address to serve on, e.g. ":7946"
+	Advertise    string   `json:"advertise"`     // host:port other nodes use to reach us, defaults to EIP and bind port
+	Seeds        []string `json:"seeds"`         // host:port of nodes to contact until peers are discovered
+	Fanout       int      `json:"fanout"`        // peers each message is sent to, 0 sends to every known peer
+	Hops         int      `json:"hops"`          // times a message is forwarded when fanout is limited
+	SyncInterval int      `json:"sync-interval"` // seconds between membership exchanges
+	PeerTimeout  int      `json:"peer-timeout"`  // seconds after which a silent peer is forgotten
+}
+
+func (c *Config) validate() error {
+	if c.Bind == "" {
+		return errors.New("missing bind field")
+	}
+	if c.Advertise == "" {
+		_, port, err := net.SplitHostPort(c.Bind)
+		if err != nil {
+			return errors.Wrap(err, "invalid bind field")
+		}
+		if node.Self.EIP == nil {
+			return errors.New("missing advertise field and no external IP is known")
+		}
+		c.Advertise = net.JoinHostPort(node.Self.EIP.String(), port)
+	}
+	if c.Fanout < 0 {
+		return errors.New("fanout can't be negative")
+	}
+	if c.Fanout > 0 && c.Hops == 0 {
+		c.Hops = 3
+	}
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = 10
+	}
+	if c.PeerTimeout <= 0 {
+		c.PeerTimeout = 60
+	}
+	return nil
+}
+
+var conf Config
+var confLock sync.RWMutex
+var started sync.Once
+var startErr error
+
+// current returns the package configuration. The server may already be running when further configuration is merged
+// in, so it must always be read through current.
+func current() Config {
+	confLock.RLock()
+	defer confLock.RUnlock()
+	return conf
+}
+
+// configure merges a configuration block into the package configuration and starts the gossip server if it isn't
+// already running.
+func configure(config json.RawMessage, ll logrus.Level) error {
+	if log == nil {
+		log = logger.New("gossip", ll)
+	}
+	c := current()
+	if err := json.Unmarshal(config, &c); err != nil {
+		return errors.Wrap(err, "could not parse configuration")
+	}
+	if err := c.validate(); err != nil {
+		return errors.Wrap(err, "invalid configuration")
+	}
+	confLock.Lock()
+	conf = c
+	confLock.Unlock()
+	started.Do(func() {
+		startErr = start()
+	})
+	return startErr
+}
+
+func initialiseListener(config json.RawMessage, ll logrus.Level) (result chan error, hchan chan heartbeat.Beat, schan chan check.Status, err error) {
+	if err := configure(config, ll); err != nil {
+		return nil, nil, nil, err
+	}
+	log.WithField("advertise", current().Advertise).Debug("Completed gossip listener configuration")
+	return watchdog, beats, statuses, nil
+}
+
+func initialisePublisher(config json.RawMessage, ll logrus.Level) (publish.Publisher, error) {
+	if err := configure(config, ll); err != nil {
+		return publish.Publisher{}, err
+	}
+	log.WithField("fanout", current().Fanout).Debug("Completed gossip publisher configuration")
+	return publish.Publisher{Status: sendStatus, Heartbeat: sendHeartbeat}, nil
+}
+
+func init() {
+	listen.RegisterConfigFunction("gossip", initialiseListener)
+	publish.RegisterPublisherFunction("gossip", initialisePublisher)
+}
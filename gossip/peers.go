@@ -0,0 +1,130 @@
+package gossip
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// member is a single entry in the membership list exchanged between nodes.
+type member struct {
+	Addr     string    `json:"addr"`
+	LastSeen time.Time `json:"last-seen"`
+}
+
+// peerSet tracks the nodes we know about, keyed by advertised address.
+type peerSet struct {
+	sync.Mutex
+	peers map[string]time.Time
+}
+
+var peers = peerSet{peers: make(map[string]time.Time)}
+
+// seen records that a peer was known to be alive at the given time, keeping the most recent sighting.
+func (p *peerSet) seen(addr string, at time.Time) {
+	if addr == "" || addr == current().Advertise {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if last, ok := p.peers[addr]; !ok {
+		log.WithField("peer", addr).Info("discovered gossip peer")
+	} else if last.After(at) {
+		return
+	}
+	p.peers[addr] = at
+}
+
+// merge folds a membership list received from another node into our own.
+func (p *peerSet) merge(ms []member) {
+	for _, m := range ms {
+		p.seen(m.Addr, m.LastSeen)
+	}
+}
+
+// list returns our membership list, including ourselves so the receiver can learn our address.
+func (p *peerSet) list() (ms []member) {
+	p.Lock()
+	defer p.Unlock()
+	ms = append(ms, member{current().Advertise, time.Now()})
+	for addr, last := range p.peers {
+		ms = append(ms, member{addr, last})
+	}
+	return
+}
+
+// expire forgets peers that haven't been heard from within the peer timeout.
+func (p *peerSet) expire() {
+	timeout := time.Duration(current().PeerTimeout) * time.Second
+	p.Lock()
+	defer p.Unlock()
+	for addr, last := range p.peers {
+		if time.Since(last) > timeout {
+			log.WithField("peer", addr).Info("forgetting silent gossip peer")
+			delete(p.peers, addr)
+		}
+	}
+}
+
+// pick returns up to n randomly chosen peers other than those excluded, or every peer when n is zero. Seeds are used
+// when no peers are known so that a new or isolated node can find its way back into the cluster.
+func (p *peerSet) pick(n int, exclude ...string) (addrs []string) {
+	p.Lock()
+	for addr := range p.peers {
+		addrs = append(addrs, addr)
+	}
+	p.Unlock()
+	if len(addrs) == 0 {
+		addrs = append(addrs, current().Seeds...)
+	}
+	addrs = without(addrs, exclude...)
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	if n > 0 && n < len(addrs) {
+		addrs = addrs[:n]
+	}
+	return
+}
+
+func without(addrs []string, exclude ...string) (r []string) {
+outer:
+	for _, a := range addrs {
+		for _, e := range exclude {
+			if a == e {
+				continue outer
+			}
+		}
+		r = append(r, a)
+	}
+	return
+}
+
+// seenRumors remembers recently received rumor IDs so that messages arriving by more than one route are delivered
+// once.
+type seenRumors struct {
+	sync.Mutex
+	ids map[string]time.Time
+}
+
+var seenIDs = seenRumors{ids: make(map[string]time.Time)}
+
+// first records the ID and reports whether this is the first time it's been seen.
+func (s *seenRumors) first(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	s.ids[id] = time.Now()
+	return true
+}
+
+// expire forgets IDs old enough that any duplicate would have arrived already.
+func (s *seenRumors) expire() {
+	s.Lock()
+	defer s.Unlock()
+	for id, t := range s.ids {
+		if time.Since(t) > 2*time.Minute {
+			delete(s.ids, id)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package gossip
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/logger"
+	"testing"
+	"time"
+)
+
+func init() {
+	log = logger.New("gossip", logrus.FatalLevel)
+	conf = Config{Advertise: "10.0.0.1:7946", Seeds: []string{"10.0.0.9:7946"}, PeerTimeout: 60}
+}
+
+func TestMerge(t *testing.T) {
+	ps := peerSet{peers: make(map[string]time.Time)}
+	old := time.Now().Add(-time.Hour)
+	ps.seen("10.0.0.2:7946", time.Now())
+	ps.merge([]member{
+		{"10.0.0.1:7946", time.Now()}, // ourselves, should be ignored
+		{"10.0.0.2:7946", old},        // older than what we know, should be ignored
+		{"10.0.0.3:7946", old},        // new to us
+	})
+	if len(ps.peers) != 2 {
+		t.Fatalf("Error in merge(), expected 2 peers, got %v", ps.peers)
+	}
+	if ps.peers["10.0.0.2:7946"].Equal(old) {
+		t.Error("Error in merge(), an older sighting replaced a newer one")
+	}
+	ps.expire()
+	if _, ok := ps.peers["10.0.0.3:7946"]; ok {
+		t.Error("Error in expire(), a silent peer was retained")
+	}
+}
+
+func TestPick(t *testing.T) {
+	ps := peerSet{peers: make(map[string]time.Time)}
+	if p := ps.pick(0); len(p) != 1 || p[0] != "10.0.0.9:7946" {
+		t.Errorf("Error in pick(), expected seed when no peers are known, got %v", p)
+	}
+	for _, a := range []string{"10.0.0.2:7946", "10.0.0.3:7946", "10.0.0.4:7946"} {
+		ps.seen(a, time.Now())
+	}
+	if p := ps.pick(0, "10.0.0.2:7946"); len(p) != 2 {
+		t.Errorf("Error in pick(), expected all peers but the excluded one, got %v", p)
+	}
+	if p := ps.pick(1); len(p) != 1 {
+		t.Errorf("Error in pick(), expected one peer, got %v", p)
+	}
+}
+
+func TestSeenRumors(t *testing.T) {
+	s := seenRumors{ids: make(map[string]time.Time)}
+	if !s.first("a") {
+		t.Error("Error in first(), new ID reported as seen")
+	}
+	if s.first("a") {
+		t.Error("Error in first(), repeated ID reported as new")
+	}
+}
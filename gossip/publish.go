@@ -0,0 +1,82 @@
+package gossip
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// sendStatus is a thin wrapper around spread, turns the sealed status into a "status" rumor
+func sendStatus(ctx context.Context, status check.Status, msg []byte) error {
+	ru, err := newRumor("status", msg)
+	if err != nil {
+		return err
+	}
+	return spread(ctx, ru)
+}
+
+// sendHeartbeat is a thin wrapper around spread, turns the sealed heartbeat into a "heartbeat" rumor
+func sendHeartbeat(ctx context.Context, beat heartbeat.Beat, msg []byte) error {
+	ru, err := newRumor("heartbeat", msg)
+	if err != nil {
+		return err
+	}
+	return spread(ctx, ru)
+}
+
+func newRumor(msgType string, payload []byte) (rumor, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return rumor{}, errors.Wrap(err, "could not generate rumor ID")
+	}
+	c := current()
+	ru := rumor{
+		ID:      hex.EncodeToString(id),
+		From:    c.Advertise,
+		Type:    msgType,
+		Hops:    c.Hops,
+		Payload: payload,
+	}
+	seenIDs.first(ru.ID) // don't deliver our own rumor back to ourselves if a peer forwards it
+	return ru, nil
+}
+
+// spread sends a rumor to the configured number of peers in parallel. It's an error only if there were peers to send
+// to and none of them accepted the rumor; a lone node has nobody to tell and that's not a failure.
+func spread(ctx context.Context, ru rumor, exclude ...string) error {
+	addrs := peers.pick(current().Fanout, append(exclude, ru.From)...)
+	if len(addrs) == 0 {
+		log.Debug("no gossip peers known, not sending")
+		return nil
+	}
+	b, err := json.Marshal(ru)
+	if err != nil {
+		return errors.Wrap(err, "could not serialise rumor")
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var delivered int
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if _, err := post(ctx, addr, "rumor", "application/json", b); err != nil {
+				log.WithError(err).WithField("peer", addr).Debug("failed to send rumor")
+				return
+			}
+			mu.Lock()
+			delivered++
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	if delivered == 0 {
+		return errors.New("no gossip peers accepted the message")
+	}
+	return nil
+}
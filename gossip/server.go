@@ -0,0 +1,215 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// rumor is the unit of exchange between nodes. It wraps a status or heartbeat with enough information to route it
+// onwards and to discover the node that originated it.
+type rumor struct {
+	ID      string `json:"id"`      // random identifier used to drop duplicates
+	From    string `json:"from"`    // advertised address of the sending node, unauthenticated so only used for routing
+	Type    string `json:"type"`    // "status" or "heartbeat"
+	Hops    int    `json:"hops"`    // remaining number of times the rumor may be forwarded
+	Payload []byte `json:"payload"` // the sealed status or heartbeat
+}
+
+var watchdog = make(chan error, 10)
+var beats = make(chan heartbeat.Beat)
+var statuses = make(chan check.Status)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// start launches the HTTP server, the membership exchange and the watchdog reporter.
+func start() error {
+	c := current()
+	for _, s := range c.Seeds {
+		peers.seen(s, time.Now())
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gossip/rumor", handleRumor)
+	mux.HandleFunc("/gossip/members", handleMembers)
+	ln, err := net.Listen("tcp", c.Bind)
+	if err != nil {
+		return errors.Wrap(err, "could not start gossip server")
+	}
+	server := &http.Server{Handler: mux}
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.Serve(ln)
+	}()
+
+	go exchangeMembers()
+	go func() {
+		heartbeatTimer := time.NewTicker(heartbeat.RoutineInterval())
+		defer heartbeatTimer.Stop()
+		for {
+			select {
+			case err := <-failed:
+				watchdog <- errors.Wrap(err, "gossip server stopped")
+				return
+			case <-heartbeatTimer.C:
+				watchdog <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+			}
+		}
+	}()
+	return nil
+}
+
+// handleRumor delivers a newly seen rumor locally and passes it on.
+func handleRumor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var ru rumor
+	if err := json.NewDecoder(r.Body).Decode(&ru); err != nil {
+		log.WithError(err).Warn("failed to decode a rumor, skipping")
+		http.Error(w, "bad rumor", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if !seenIDs.first(ru.ID) {
+		return
+	}
+	deliver(r.Context(), ru)
+	if ru.Hops > 0 {
+		ru.Hops--
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := spread(ctx, ru, ru.From); err != nil {
+				log.WithError(err).Debug("failed to forward rumor")
+			}
+		}()
+	}
+}
+
+// deliver opens a rumor's payload and passes it to the listen routine. Peers aren't learned from rumors: the sender's
+// address isn't covered by the seal, so anyone could wrap a captured heartbeat with their own. Each node announces
+// itself in the authenticated membership exchange instead.
+func deliver(ctx context.Context, ru rumor) {
+	v, err := envelope.Open(ru.Payload)
+	if err != nil {
+		if envelope.Duplicate(err) {
+			return // already received over another path
+		}
+		log.WithFields(logrus.Fields{
+			"error": err,
+			"from":  ru.From,
+		}).Warn("dropped a rumor")
+		return
+	}
+	switch m := v.(type) {
+	case check.Status:
+		log.Info("received a Status")
+		log.WithFields(logrus.Fields{
+			"status": fmt.Sprintf("%#v", m),
+		}).Debug("decoded a Status")
+		select {
+		case statuses <- m:
+		case <-ctx.Done():
+		}
+	case heartbeat.Beat:
+		log.Info("received a Heartbeat")
+		log.WithFields(logrus.Fields{
+			"beat": fmt.Sprintf("%#v", m),
+		}).Debug("decoded a Heartbeat")
+		select {
+		case beats <- m:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// handleMembers merges the caller's membership list into ours and replies with our own.
+func handleMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		http.Error(w, "bad membership list", http.StatusBadRequest)
+		return
+	}
+	var ms []member
+	// Membership lists are authenticated like rumors, or anyone able to reach us could inject peers
+	if err := envelope.OpenMessage(body.Bytes(), "members", &ms); err != nil {
+		log.WithError(err).WithField("remote", r.RemoteAddr).Warn("dropped a membership list")
+		http.Error(w, "bad membership list", http.StatusForbidden)
+		return
+	}
+	peers.merge(ms)
+	reply, err := envelope.SealMessage("members", peers.list())
+	if err != nil {
+		log.WithError(err).Warn("failed to seal membership list")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := w.Write(reply); err != nil {
+		log.WithError(err).Warn("failed to send membership list")
+	}
+}
+
+// exchangeMembers periodically swaps membership lists with one random peer (anti-entropy), so that nodes learn of
+// peers they haven't heard from directly and forget those nobody has heard from.
+func exchangeMembers() {
+	for range time.Tick(time.Duration(current().SyncInterval) * time.Second) {
+		peers.expire()
+		seenIDs.expire()
+		for _, addr := range peers.pick(1) {
+			ours, err := envelope.SealMessage("members", peers.list())
+			if err != nil {
+				log.WithError(err).Warn("failed to seal membership list")
+				continue
+			}
+			reply, err := post(context.Background(), addr, "members", "application/octet-stream", ours)
+			if err != nil {
+				log.WithError(err).WithField("peer", addr).Debug("membership exchange failed")
+				continue
+			}
+			var theirs []member
+			if err := envelope.OpenMessage(reply, "members", &theirs); err != nil {
+				log.WithError(err).WithField("peer", addr).Warn("dropped a membership list")
+				continue
+			}
+			peers.merge(theirs)
+		}
+	}
+}
+
+// post sends a body to a peer's gossip endpoint and returns the response body.
+func post(ctx context.Context, addr, endpoint, contentType string, b []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v/gossip/%v", addr, endpoint), bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(res.Body); err != nil {
+		return nil, errors.Wrap(err, "could not read response")
+	}
+	if res.StatusCode/100 != 2 {
+		return nil, errors.Errorf("peer responded %v", res.Status)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,67 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleMembers(t *testing.T) {
+	raw := json.RawMessage(`{"mode": "hmac", "hmac-key": "correct horse battery staple"}`)
+	if err := envelope.Initialise(&raw, logrus.FatalLevel); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	defer func() { peers = peerSet{peers: make(map[string]time.Time)} }()
+
+	post := func(body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handleMembers(w, httptest.NewRequest(http.MethodPost, "/gossip/members", bytes.NewReader(body)))
+		return w
+	}
+
+	// An unauthenticated list must not add peers
+	forged, _ := json.Marshal([]member{{"10.0.0.66:7946", time.Now()}})
+	if w := post(forged); w.Code != http.StatusForbidden {
+		t.Errorf("Error in handleMembers(), expected an unsealed list to be refused, got %v", w.Code)
+	}
+	if _, ok := peers.peers["10.0.0.66:7946"]; ok {
+		t.Errorf("Error in handleMembers(), an unsealed list added a peer")
+	}
+
+	sealed, _ := envelope.SealMessage("members", []member{{"10.0.0.5:7946", time.Now()}})
+	w := post(sealed)
+	var reply []member
+	if err := envelope.OpenMessage(w.Body.Bytes(), "members", &reply); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Error in handleMembers(), expected a sealed reply, got %v and %v", w.Code, err)
+	}
+	if _, ok := peers.peers["10.0.0.5:7946"]; !ok || len(reply) != 2 {
+		t.Errorf("Error in handleMembers(), expected the sealed list to be merged, got %v", reply)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	raw := json.RawMessage(`{"mode": "hmac", "hmac-key": "correct horse battery staple"}`)
+	if err := envelope.Initialise(&raw, logrus.FatalLevel); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	defer func() { peers = peerSet{peers: make(map[string]time.Time)} }()
+
+	// A genuine heartbeat wrapped by someone else mustn't make them a peer
+	payload, err := envelope.Seal(heartbeat.NewBeat())
+	if err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deliver(ctx, rumor{ID: "forged", From: "10.0.0.66:7946", Type: "heartbeat", Payload: payload})
+	if len(peers.peers) != 0 {
+		t.Errorf("Error in deliver(), expected no peers to be learned from a rumor, got %v", peers.peers)
+	}
+}
@@ -11,15 +11,27 @@ type Beat struct {
 	Coordinator bool
 	Feasible    bool
 	Timestamp   time.Time
+	Term        uint64    // election term in which the Coordinator role was won, where the strategy has terms
+	Epoch       uint64    // epoch of the Coordinator's lease, or the highest known to any other node, see Acquire
+	Priority    int       // preference for the Coordinator role, higher wins before the lowest ID is considered
+	Ineligible  bool      // never take either role, inverted so Beats from older nodes are eligible
+	Version     string    // dpoller build the node is running
+	NodeRole    node.Role // part the node plays in the cluster, empty for nodes that predate roles
 }
 
 // NewBeat returns an initialised Beat.
 func NewBeat() Beat {
 	return Beat{
-		node.Self,
-		coordinator,
-		feasibleCoordinator,
-		time.Now(),
+		Node:        node.Self,
+		Coordinator: GetCoordinator(),
+		Feasible:    feasibleCoordinator,
+		Timestamp:   time.Now(),
+		Term:        term,
+		Epoch:       advertisedEpoch(),
+		Priority:    priority,
+		Ineligible:  !eligible,
+		Version:     node.Version,
+		NodeRole:    node.SelfRole,
 	}
 }
 
@@ -27,18 +39,54 @@ func NewBeat() Beat {
 // hold Coordinator or Feasible Coordinator position.
 // var Self Beat
 
+// coordinator is guarded by the lease lock, as HoldsLease reads it alongside the lease from other routines.
 var coordinator bool
 
 // GetCoordinator gets current coordinator status
 func GetCoordinator() bool {
+	lease.Lock()
+	defer lease.Unlock()
 	return coordinator
 }
 
 // SetCoordinator sets current coordinator status
 func SetCoordinator(b bool) {
+	lease.Lock()
+	defer lease.Unlock()
 	coordinator = b
 }
 
+var term uint64
+
+// GetTerm gets the current election term
+func GetTerm() uint64 {
+	return term
+}
+
+// SetTerm sets the current election term
+func SetTerm(t uint64) {
+	term = t
+}
+
+var priority int
+
+// SetPriority sets this node's preference for the Coordinator role
+func SetPriority(p int) {
+	priority = p
+}
+
+var eligible = true
+
+// GetEligible gets whether this node may hold the Coordinator or Feasible Coordinator role
+func GetEligible() bool {
+	return eligible
+}
+
+// SetEligible sets whether this node may hold the Coordinator or Feasible Coordinator role
+func SetEligible(b bool) {
+	eligible = b
+}
+
 var feasibleCoordinator bool
 
 // GetFeasibleCoordinator gets current feasible coordinator status
@@ -50,3 +98,15 @@ func GetFeasibleCoordinator() bool {
 func SetFeasibleCoordinator(b bool) {
 	feasibleCoordinator = b
 }
+
+// NewObituary returns a Beat announcing that this node has left the cluster. Transports that can deliver a message on
+// a node's behalf after it disconnects (e.g. an MQTT last will) send one so other nodes can forget the node at once
+// rather than waiting for its last Beat to age out.
+func NewObituary() Beat {
+	return Beat{Node: node.Self}
+}
+
+// IsObituary reports whether the Beat announces a node's departure rather than its presence.
+func (b Beat) IsObituary() bool {
+	return b.Timestamp.IsZero()
+}
@@ -9,26 +9,26 @@ import (
 )
 
 var node1 = node.Node{
-	1000000000000000000,
-	net.IP{10, 0, 0, 1},
-	"test_node_1",
+	ID:   1000000000000000000,
+	EIP:  net.IP{10, 0, 0, 1},
+	Name: "test_node_1",
 }
 var node2 = node.Node{
-	2000000000000000000,
-	net.IP{10, 0, 0, 2},
-	"test_node_2",
+	ID:   2000000000000000000,
+	EIP:  net.IP{10, 0, 0, 2},
+	Name: "test_node_2",
 }
 
 /*
 var node3 = node.Node{
-	3000000000000000000,
-	net.IP{10, 0, 0, 3},
-	"test_node_3",
+	ID:   3000000000000000000,
+	EIP:  net.IP{10, 0, 0, 3},
+	Name: "test_node_3",
 }
 var node4 = node.Node{
-	4000000000000000000,
-	net.IP{10, 0, 0, 4},
-	"test_node_4",
+	ID:   4000000000000000000,
+	EIP:  net.IP{10, 0, 0, 4},
+	Name: "test_node_4",
 }
 */
 // All tests use the same simulated time for each heartbeat as time is not currently a factor in tested functions
@@ -39,22 +39,22 @@ func TestEvaluate(t *testing.T) {
 	Initialise(logrus.FatalLevel)
 
 	// Using descriptive variables for the various possible states of the nodes makes the tests clearer
-	nodeOneCoordinator := Beat{node1, true, false, testtime}
-	nodeOneFeasible := Beat{node1, false, true, testtime}
-	nodeOneBoth := Beat{node1, true, true, testtime} // Shouldn't occur in normal operation
-	nodeOneNone := Beat{node1, false, false, testtime}
-	nodeTwoCoordinator := Beat{node2, true, false, testtime}
-	nodeTwoFeasible := Beat{node2, false, true, testtime}
-	//	nodeTwoBoth := Beat{node2, true, true, testtime} // Shouldn't occur in normal operation
-	nodeTwoNone := Beat{node2, false, false, testtime}
-	//	nodeThreeCoordinator := Beat{node3, true, false, testtime}
-	//	nodeThreeFeasible := Beat{node3, false, true, testtime}
-	//	nodeThreeBoth := Beat{node3, true, true, testtime} // Shouldn't occur in normal operation
-	//	nodeThreeNone := Beat{node3, false, false, testtime}
-	//	nodeFourCoordinator := Beat{node4, true, false, testtime}
-	//	nodeFourFeasible := Beat{node4, false, true, testtime}
-	//	nodeFourBoth := Beat{node4, true, true, testtime} // Shouldn't occur in normal operation
-	//	nodeFourNone := Beat{node4, false, false, testtime}
+	nodeOneCoordinator := Beat{Node: node1, Coordinator: true, Feasible: false, Timestamp: testtime}
+	nodeOneFeasible := Beat{Node: node1, Coordinator: false, Feasible: true, Timestamp: testtime}
+	nodeOneBoth := Beat{Node: node1, Coordinator: true, Feasible: true, Timestamp: testtime} // Shouldn't occur in normal operation
+	nodeOneNone := Beat{Node: node1, Coordinator: false, Feasible: false, Timestamp: testtime}
+	nodeTwoCoordinator := Beat{Node: node2, Coordinator: true, Feasible: false, Timestamp: testtime}
+	nodeTwoFeasible := Beat{Node: node2, Coordinator: false, Feasible: true, Timestamp: testtime}
+	//	nodeTwoBoth := Beat{Node: node2, Coordinator: true, Feasible: true, Timestamp: testtime} // Shouldn't occur in normal operation
+	nodeTwoNone := Beat{Node: node2, Coordinator: false, Feasible: false, Timestamp: testtime}
+	//	nodeThreeCoordinator := Beat{Node: node3, Coordinator: true, Feasible: false, Timestamp: testtime}
+	//	nodeThreeFeasible := Beat{Node: node3, Coordinator: false, Feasible: true, Timestamp: testtime}
+	//	nodeThreeBoth := Beat{Node: node3, Coordinator: true, Feasible: true, Timestamp: testtime} // Shouldn't occur in normal operation
+	//	nodeThreeNone := Beat{Node: node3, Coordinator: false, Feasible: false, Timestamp: testtime}
+	//	nodeFourCoordinator := Beat{Node: node4, Coordinator: true, Feasible: false, Timestamp: testtime}
+	//	nodeFourFeasible := Beat{Node: node4, Coordinator: false, Feasible: true, Timestamp: testtime}
+	//	nodeFourBoth := Beat{Node: node4, Coordinator: true, Feasible: true, Timestamp: testtime} // Shouldn't occur in normal operation
+	//	nodeFourNone := Beat{Node: node4, Coordinator: false, Feasible: false, Timestamp: testtime}
 
 	tables := []struct {
 		description   string
@@ -82,7 +82,12 @@ func TestEvaluate(t *testing.T) {
 
 	for _, table := range tables {
 
-		isCoord, isFeas := table.knownBeats.Evaluate(table.self.Coordinator, table.self.Feasible, table.self.ID)
+		d, err := table.knownBeats.Evaluate(table.self.Coordinator, table.self.Feasible, table.self.ID)
+		if err != nil {
+			t.Errorf("Error in Evaluate() for case \"%s\": %v", table.description, err)
+			continue
+		}
+		isCoord, isFeas := d.IsCoordinator(), d.IsFeasible()
 		if isFeas != table.shouldBeFeas {
 			t.Errorf("Error in Evaluate() for case \"%s\", Feasible was %t, should be %t", table.description, isFeas, table.shouldBeFeas)
 		}
@@ -91,3 +96,92 @@ func TestEvaluate(t *testing.T) {
 		}
 	}
 }
+
+func TestEvaluatePriority(t *testing.T) {
+
+	Initialise(logrus.FatalLevel)
+
+	// node2 has the higher ID but is preferred by priority, node1 is ineligible in some cases
+	oneNone := Beat{Node: node1, Timestamp: testtime}
+	oneCoordinator := Beat{Node: node1, Coordinator: true, Timestamp: testtime}
+	oneFeasible := Beat{Node: node1, Feasible: true, Timestamp: testtime}
+	oneIneligible := Beat{Node: node1, Ineligible: true, Timestamp: testtime}
+	twoNone := Beat{Node: node2, Priority: 10, Timestamp: testtime}
+	twoFeasible := Beat{Node: node2, Feasible: true, Priority: 10, Timestamp: testtime}
+	twoCoordinator := Beat{Node: node2, Coordinator: true, Priority: 10, Timestamp: testtime}
+
+	tables := []struct {
+		description   string
+		knownBeats    Beats
+		self          Beat
+		shouldBeCoord bool
+		shouldBeFeas  bool
+	}{
+		{"priority beats lower ID, winners perspective", Beats{oneNone, twoNone}, twoNone, false, true},
+		{"priority beats lower ID, losers perspective", Beats{oneNone, twoNone}, oneNone, false, false},
+		{"two coordinators, priority wins", Beats{oneCoordinator, twoCoordinator}, twoCoordinator, true, false},
+		{"two coordinators, lower priority yields", Beats{oneCoordinator, twoCoordinator}, oneCoordinator, false, false},
+		{"feasible yields to higher priority", Beats{oneFeasible, twoNone}, oneFeasible, false, false},
+		{"coordinator keeps role until preferred node stands by", Beats{oneCoordinator, twoNone}, oneCoordinator, true, false},
+		{"preferred node stands by", Beats{oneCoordinator, twoNone}, twoNone, false, true},
+		{"coordinator hands over to preferred standby", Beats{oneCoordinator, twoFeasible}, oneCoordinator, false, false},
+		{"preferred standby is promoted", Beats{oneNone, twoFeasible}, twoFeasible, true, false},
+		{"ineligible node alone", Beats{oneIneligible}, oneIneligible, false, false},
+		{"ineligible node is skipped", Beats{oneIneligible, Beat{Node: node2, Timestamp: testtime}}, Beat{Node: node2}, false, true},
+	}
+
+	for _, table := range tables {
+
+		d, err := table.knownBeats.Evaluate(table.self.Coordinator, table.self.Feasible, table.self.ID)
+		if err != nil {
+			t.Errorf("Error in Evaluate() for case \"%s\": %v", table.description, err)
+			continue
+		}
+		isCoord, isFeas := d.IsCoordinator(), d.IsFeasible()
+		if isFeas != table.shouldBeFeas {
+			t.Errorf("Error in Evaluate() for case \"%s\", Feasible was %t, should be %t", table.description, isFeas, table.shouldBeFeas)
+		}
+		if isCoord != table.shouldBeCoord {
+			t.Errorf("Error in Evaluate() for case \"%s\", Coordinator was %t, should be %t", table.description, isCoord, table.shouldBeCoord)
+		}
+	}
+}
+
+func TestEvaluateDecision(t *testing.T) {
+
+	Initialise(logrus.FatalLevel)
+
+	oneCoordinator := Beat{Node: node1, Coordinator: true, Timestamp: testtime}
+	oneFeasible := Beat{Node: node1, Feasible: true, Timestamp: testtime}
+	twoNone := Beat{Node: node2, Timestamp: testtime}
+	twoCoordinator := Beat{Node: node2, Coordinator: true, Timestamp: testtime}
+
+	tables := []struct {
+		description string
+		knownBeats  Beats
+		self        Beat
+		role        Role
+		coordinator int64
+	}{
+		{"promotion names self", Beats{oneFeasible, twoNone}, oneFeasible, CoordinatorRole, node1.ID},
+		{"follower names the coordinator", Beats{oneCoordinator, twoNone}, twoNone, FeasibleRole, node1.ID},
+		{"losing coordinator names the winner", Beats{oneCoordinator, twoCoordinator}, twoCoordinator, NoRole, node1.ID},
+		{"no coordinator known", Beats{oneFeasible, twoNone}, twoNone, NoRole, 0},
+	}
+	for _, table := range tables {
+		d, err := table.knownBeats.Evaluate(table.self.Coordinator, table.self.Feasible, table.self.ID)
+		if err != nil {
+			t.Errorf("Error in Evaluate() for case %q: %v", table.description, err)
+			continue
+		}
+		if d.Role != table.role || d.Coordinator != table.coordinator || d.Reason == "" {
+			t.Errorf("Error in Evaluate() for case %q, expected %v under %v, got %+v", table.description, table.role,
+				table.coordinator, d)
+		}
+	}
+
+	_, err := Beats{twoNone}.Evaluate(false, false, node1.ID)
+	if e, ok := err.(MissingSelfError); !ok || e.ID != node1.ID {
+		t.Errorf("Error in Evaluate() without self, expected MissingSelfError, got %v", err)
+	}
+}
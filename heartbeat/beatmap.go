@@ -10,13 +10,13 @@ func NewBeatMap() BeatMap {
 	return make(map[int64]Beat)
 }
 
-// AgeOut removes beats that have not been seen in the last 21 seconds. This is the time required for a node to be
+// AgeOut removes beats that have not been seen within the age-out interval. This is the time required for a node to be
 // unresponsive before it will be ignored.
 // The time is selected as a compromise between the risk of creating network partitions and the risk of missing
 // failed tests that require alerting.
 func (bm BeatMap) AgeOut() {
 	for k, v := range bm {
-		if time.Since(v.Timestamp) > 21*time.Second {
+		if time.Since(v.Timestamp) > AgeOutAfter() {
 			delete(bm, k)
 		}
 	}
@@ -28,75 +28,131 @@ func (beats Beats) FeasCount() (count int) {
 	return
 }
 
-func (beats Beats) bestActiveCoord() (coordID int64, e error) {
-	e = fmt.Errorf("no values")
-	coordID = math.MaxInt64
-	for _, b := range beats {
-		e = nil
-		if (b.ID < coordID) && b.Coordinator {
-			coordID = b.ID
+// outranks reports whether b should be preferred over o for a role: higher priority first, then lower ID.
+func (b Beat) outranks(o Beat) bool {
+	if b.Priority != o.Priority {
+		return b.Priority > o.Priority
+	}
+	return b.ID < o.ID
+}
+
+// best returns the ID of the highest-ranked eligible node matching the filter.
+func (beats Beats) best(filter func(Beat) bool) (id int64, e error) {
+	var top *Beat
+	for i, b := range beats {
+		if !b.Ineligible && filter(b) && (top == nil || b.outranks(*top)) {
+			top = &beats[i]
 		}
 	}
-	return
+	if top == nil {
+		return math.MaxInt64, fmt.Errorf("no values")
+	}
+	return top.ID, nil
 }
 
-func (beats Beats) bestFeas() (feasID int64, e error) {
-	e = fmt.Errorf("no values")
-	feasID = math.MaxInt64
+func (beats Beats) bestActiveCoord() (coordID int64, e error) {
+	w, ok := beats.Winner()
+	if !ok {
+		return math.MaxInt64, fmt.Errorf("no values")
+	}
+	return w.ID, nil
+}
+
+// Winner returns the Coordinator that keeps the role when more than one claims it: the one holding the latest lease,
+// or the highest ranked if their leases are equal. Every node that can see the same Coordinators picks the same
+// winner, so the others can stand down at once rather than waiting for the cluster to converge.
+func (beats Beats) Winner() (w Beat, ok bool) {
 	for _, b := range beats {
-		e = nil
-		if b.ID < feasID && !b.Coordinator {
-			feasID = b.ID
+		if !b.Coordinator {
+			continue
+		}
+		if !ok || b.Epoch > w.Epoch || (b.Epoch == w.Epoch && b.outranks(w)) {
+			w, ok = b, true
 		}
 	}
 	return
 }
 
+// Standby returns the ID of the highest-ranked eligible node not holding the Coordinator role.
+func (beats Beats) Standby() (int64, error) {
+	return beats.bestFeas()
+}
+
+func (beats Beats) bestFeas() (feasID int64, e error) {
+	return beats.best(func(b Beat) bool { return !b.Coordinator })
+}
+
 func (beats Beats) bestActiveFeas() (feasID int64, e error) {
-	e = fmt.Errorf("no values")
-	feasID = math.MaxInt64
+	return beats.best(func(b Beat) bool { return b.Feasible })
+}
+
+// outranked reports whether any eligible node matching the filter has a higher priority than the given Beat. Unlike
+// outranks it ignores IDs, so nodes of equal priority never displace each other.
+func (beats Beats) outranked(self Beat, filter func(Beat) bool) bool {
 	for _, b := range beats {
-		if (b.ID < feasID) && b.Feasible {
-			e = nil
-			feasID = b.ID
+		if !b.Ineligible && filter(b) && b.Priority > self.Priority {
+			return true
 		}
 	}
-	return
+	return false
 }
 
-func (beats Beats) checkIdExists(nodeID int64) bool {
+func (beats Beats) find(nodeID int64) (Beat, bool) {
 	for _, b := range beats {
 		if b.ID == nodeID {
-			return true
+			return b, true
 		}
 	}
-	return false
+	return Beat{}, false
 }
 
-// Evaluate assesses the set of known nodes to determine which node has/should have the Coordinator role. It implements
-// the following decision tree:
+// Evaluate assesses the set of known nodes to determine which node has/should have the Coordinator role. Nodes are
+// ranked by priority and then by lowest ID, and ineligible nodes never take either role. It implements the following
+// decision tree:
+// - If this node is ineligible, hold no roles
 // - If there's no coordinator and this node is the best feasible coordinator, take the role
 // - If there's one or more coordinators and this node is one of them:
 // -- If this node is the best coordinator no action is required
-// -- If this node is not the best coordinator, reset to no roles
+// -- If this node is not the best coordinator, or a higher-priority Feasible Coordinator is standing by, reset to no roles
 // - If there's no feasible coordinator and this node is the best feasible coordinator, take the role
 // - If there's one or more feasible coordinators and this node is one of them:
 // -- If this node is the best feasible coordinator no action is required
-// -- If this node is not the best feasible coordinator reset to no roles
+// -- If this node is not the best feasible coordinator, or a higher-priority node is available, reset to no roles
 // - Finally, if there's a coordinator and feasible coordinator but we're not them, no action is required.
+// Stepping down for a higher-priority node lets the cluster move the Coordinator role back to a preferred node once it
+// reappears, and waiting for that node to become the Feasible Coordinator first means the handover is never left to a
+// lower-priority standby.
 // Implementing this as a two-phase selection is intended to keep the inevitable flapping due to unreliable networks at
 // the first phase. If a coordinator loses its position it won't immediately compete for it again which should reduce
 // the rate of role-change.
 // It's possible that the evaluation algorithm could be modified to take into account perceived connection stability
 // (perhaps based on number of known nodes) but the current one has the advantage of being very simple to reason about.
-func (beats Beats) Evaluate(isCoord, isFeas bool, nodeID int64) (shouldBeCoordinator, shouldBeFeasible bool) {
+// A MissingSelfError is returned if the Beats don't include nodeID.
+func (beats Beats) Evaluate(isCoord, isFeas bool, nodeID int64) (Decision, error) {
 
 	// Beats must include the given nodeID or we can't continue - enforcing this constraint simplifies this method and
 	// puts responsibility back on the caller to provide sane data
-	// TODO: Extend the Evaluate() method to throw an error instead of panicking
-	if !beats.checkIdExists(nodeID) {
-		log.WithField("beats", beats).
-			Fatal("Can't evaluate beats without self included")
+	self, ok := beats.find(nodeID)
+	if !ok {
+		return Decision{}, MissingSelfError{ID: nodeID}
+	}
+
+	var known int64
+	if w, ok := beats.Winner(); ok {
+		known = w.ID
+	}
+	decide := func(r Role, reason string) (Decision, error) {
+		d := Decision{Role: r, Reason: reason, Coordinator: known}
+		if r == CoordinatorRole {
+			d.Coordinator = nodeID
+		} else if known == nodeID {
+			d.Coordinator = 0 // we're standing down and nobody else has the role
+		}
+		return d, nil
+	}
+
+	if self.Ineligible {
+		return decide(NoRole, "ineligible")
 	}
 
 	bf, _ := beats.bestFeas()
@@ -107,9 +163,7 @@ func (beats Beats) Evaluate(isCoord, isFeas bool, nodeID int64) (shouldBeCoordin
 
 		if isFeas && bf == nodeID {
 			log.Infoln("This node is the best feasible coordinator, promote")
-			shouldBeCoordinator = true
-			shouldBeFeasible = false
-			return
+			return decide(CoordinatorRole, "promoted from feasible coordinator")
 		}
 	}
 
@@ -117,37 +171,31 @@ func (beats Beats) Evaluate(isCoord, isFeas bool, nodeID int64) (shouldBeCoordin
 	// the coordinator role and return.
 	if beats.CoordCount() > 0 && isCoord {
 		if bac, _ := beats.bestActiveCoord(); bac != nodeID {
-			shouldBeCoordinator = false
-			shouldBeFeasible = false
-			return
+			return decide(NoRole, "another coordinator takes precedence")
+		}
+		if beats.outranked(self, func(b Beat) bool { return b.Feasible }) {
+			return decide(NoRole, "handing over to a higher-priority feasible coordinator")
 		}
-		shouldBeCoordinator = true
-		shouldBeFeasible = false
-		return
+		return decide(CoordinatorRole, "remains the best coordinator")
 	}
 
 	// check if we need to take the feasible coordinator role
 	if beats.FeasCount() == 0 && bf == nodeID {
-		shouldBeCoordinator = false
-		shouldBeFeasible = true
-		return
+		return decide(FeasibleRole, "best candidate with no feasible coordinator")
 	}
 
 	// Check if we're a competing feasible coordinator. If so and we're not the best unset both roles and return,
 	// otherwise set the feasible coordinator role and return.
 	if beats.FeasCount() > 0 && isFeas {
 		if baf, _ := beats.bestActiveFeas(); baf != nodeID {
-			shouldBeCoordinator = false
-			shouldBeFeasible = false
-			return
+			return decide(NoRole, "another feasible coordinator takes precedence")
 		}
-		shouldBeCoordinator = false
-		shouldBeFeasible = true
-		return
+		if beats.outranked(self, func(b Beat) bool { return !b.Coordinator }) {
+			return decide(NoRole, "making way for a higher-priority node")
+		}
+		return decide(FeasibleRole, "remains the best feasible coordinator")
 	}
 
 	// No action required - there's a coordinator and feasible coordinator but we're not them.
-	shouldBeCoordinator = false
-	shouldBeFeasible = false
-	return
+	return decide(NoRole, "roles are held by other nodes")
 }
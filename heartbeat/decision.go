@@ -0,0 +1,63 @@
+package heartbeat
+
+import "fmt"
+
+// Role is a position a node can hold in the cluster.
+type Role int
+
+// Roles a node can hold. A node holds at most one at a time.
+const (
+	NoRole Role = iota
+	FeasibleRole
+	CoordinatorRole
+)
+
+func (r Role) String() string {
+	switch r {
+	case FeasibleRole:
+		return "feasible-coordinator"
+	case CoordinatorRole:
+		return "coordinator"
+	}
+	return "none"
+}
+
+// Role returns the role the Beat announces.
+func (b Beat) Role() Role {
+	switch {
+	case b.Coordinator:
+		return CoordinatorRole
+	case b.Feasible:
+		return FeasibleRole
+	}
+	return NoRole
+}
+
+// Decision is the outcome of an election: the role this node should hold, why, and which node it believes holds the
+// Coordinator role afterwards.
+type Decision struct {
+	Role        Role
+	Reason      string
+	Coordinator int64  // ID of the Coordinator, which may be this node, or 0 if there's none or it isn't known
+	Epoch       uint64 // lease epoch for a Coordinator, where the strategy numbers its own terms, otherwise 0
+}
+
+// IsCoordinator reports whether the node should hold the Coordinator role.
+func (d Decision) IsCoordinator() bool {
+	return d.Role == CoordinatorRole
+}
+
+// IsFeasible reports whether the node should hold the Feasible Coordinator role.
+func (d Decision) IsFeasible() bool {
+	return d.Role == FeasibleRole
+}
+
+// MissingSelfError is returned by Evaluate when the Beats don't include the evaluating node, which it needs to know
+// this node's own priority and eligibility.
+type MissingSelfError struct {
+	ID int64
+}
+
+func (e MissingSelfError) Error() string {
+	return fmt.Sprintf("can't evaluate beats without node %v included", e.ID)
+}
@@ -0,0 +1,131 @@
+package heartbeat
+
+import (
+	"sync"
+	"time"
+)
+
+// leaseDuration is how long a Coordinator lease lasts without renewal. The Coordinator renews its lease every time it
+// evaluates, so the lease is only allowed to lapse if the node stops running. It's shorter than the time it takes other
+// nodes to age out the Coordinator's heartbeat, so a paused Coordinator's lease has always expired before another node
+// can be elected in its place.
+func leaseDuration() time.Duration {
+	return seconds(Timing.Lease)
+}
+
+// lease is the Coordinator's right to act on the cluster's behalf. Each new lease has a higher epoch than any this
+// node has seen, so actions taken under an old lease can be recognised and discarded.
+var lease struct {
+	sync.Mutex
+	epoch   uint64
+	expires time.Time
+	seen    uint64    // highest epoch received in any Beat
+	wait    time.Time // no new lease until then, see MayAcquire
+}
+
+// Acquire takes a new lease with an epoch higher than the given epoch, any received in a Beat and any lease previously
+// held by this node.
+func Acquire(seen uint64) uint64 {
+	lease.Lock()
+	defer lease.Unlock()
+	for _, e := range []uint64{seen, lease.seen} {
+		if e > lease.epoch {
+			lease.epoch = e
+		}
+	}
+	lease.epoch++
+	lease.expires = time.Now().Add(leaseDuration())
+	return lease.epoch
+}
+
+// MayAcquire reports whether this node may take a new lease with Acquire. A node whose lease lapsed while it held the
+// Coordinator role was paused or cut off, so it may not know about leases taken since, and it waits until it has been
+// receiving Beats for long enough to have heard from every live node.
+func MayAcquire() bool {
+	lease.Lock()
+	defer lease.Unlock()
+	return !time.Now().Before(lease.wait)
+}
+
+// Observe records the epoch from a received Beat. Every node advertises the highest epoch it's seen, so a new lease
+// supersedes the current Coordinator's even if it was never heard from directly.
+func Observe(epoch uint64) {
+	lease.Lock()
+	defer lease.Unlock()
+	if epoch > lease.seen {
+		lease.seen = epoch
+	}
+}
+
+// AcquireAt takes or renews a lease with exactly the given epoch, for election strategies that number their own terms
+// and only ever elect one Coordinator in each. It fails if this node has already held a lease with a later epoch.
+func AcquireAt(epoch uint64) bool {
+	lease.Lock()
+	defer lease.Unlock()
+	if epoch < lease.epoch {
+		return false
+	}
+	lease.epoch = epoch
+	lease.expires = time.Now().Add(leaseDuration())
+	return true
+}
+
+// Renew extends the current lease, if it's still held. If it lapsed instead of being released, no new lease may be taken
+// for an age-out period.
+func Renew() bool {
+	lease.Lock()
+	defer lease.Unlock()
+	if !time.Now().Before(lease.expires) {
+		if !lease.expires.IsZero() {
+			lease.expires = time.Time{}
+			lease.wait = time.Now().Add(AgeOutAfter())
+		}
+		return false
+	}
+	lease.expires = time.Now().Add(leaseDuration())
+	return true
+}
+
+// Release gives up the current lease immediately. The epoch is kept so the next lease is still higher.
+func Release() {
+	lease.Lock()
+	defer lease.Unlock()
+	lease.expires = time.Time{}
+}
+
+// HoldsLease reports whether this node holds a current, unexpired Coordinator lease. Routines acting on the cluster's
+// behalf should check this immediately before acting rather than relying on the Coordinator flag, which may be stale
+// if the node was paused.
+func HoldsLease() bool {
+	lease.Lock()
+	defer lease.Unlock()
+	return coordinator && time.Now().Before(lease.expires)
+}
+
+// GetEpoch returns the epoch of the most recent lease held by this node.
+func GetEpoch() uint64 {
+	lease.Lock()
+	defer lease.Unlock()
+	return lease.epoch
+}
+
+// advertisedEpoch returns the epoch to send in this node's Beat: the Coordinator's own lease, otherwise the highest
+// epoch this node knows of.
+func advertisedEpoch() uint64 {
+	lease.Lock()
+	defer lease.Unlock()
+	if coordinator || lease.seen < lease.epoch {
+		return lease.epoch
+	}
+	return lease.seen
+}
+
+// MaxEpoch returns the highest lease epoch announced in the given Beats.
+func (beats Beats) MaxEpoch() (epoch uint64) {
+	for _, b := range beats {
+		if b.Epoch > epoch {
+			epoch = b.Epoch
+		}
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package heartbeat
+
+import (
+	"testing"
+)
+
+func TestLease(t *testing.T) {
+	defer SetCoordinator(false)
+
+	SetCoordinator(true)
+	if HoldsLease() {
+		t.Errorf("Error in HoldsLease(), expected no lease before Acquire")
+	}
+	first := Acquire(0)
+	if !HoldsLease() || !Renew() {
+		t.Errorf("Error in HoldsLease(), expected lease %v to be held", first)
+	}
+	// A new lease must supersede both our own and any seen elsewhere
+	if e := Acquire(first + 5); e != first+6 {
+		t.Errorf("Error in Acquire(), expected epoch %v, got %v", first+6, e)
+	}
+	if e := Acquire(0); e != first+7 {
+		t.Errorf("Error in Acquire(), expected epoch %v, got %v", first+7, e)
+	}
+	Release()
+	if HoldsLease() || Renew() {
+		t.Errorf("Error in Release(), expected lease to be given up")
+	}
+	if GetEpoch() != first+7 {
+		t.Errorf("Error in Release(), expected epoch to be kept, got %v", GetEpoch())
+	}
+	SetCoordinator(false)
+	Acquire(0)
+	if HoldsLease() {
+		t.Errorf("Error in HoldsLease(), expected no lease without the Coordinator role")
+	}
+}
+
+func TestAcquireAt(t *testing.T) {
+	defer SetCoordinator(false)
+
+	SetCoordinator(true)
+	first := Acquire(0)
+	if !AcquireAt(first+3) || GetEpoch() != first+3 || !HoldsLease() {
+		t.Errorf("Error in AcquireAt(), expected lease %v to be held, got %v", first+3, GetEpoch())
+	}
+	// The same term renews the lease, but an earlier one can't be taken once a later lease has been held
+	if !AcquireAt(first + 3) {
+		t.Errorf("Error in AcquireAt(), expected the current epoch to be renewed")
+	}
+	Release()
+	if AcquireAt(first+2) || HoldsLease() {
+		t.Errorf("Error in AcquireAt(), expected an earlier epoch to be refused")
+	}
+}
+
+func TestMaxEpoch(t *testing.T) {
+	beats := Beats{
+		{Node: node1, Coordinator: true, Epoch: 3},
+		{Node: node2, Feasible: true, Epoch: 9}, // passing on a later epoch it's seen
+	}
+	if e := beats.MaxEpoch(); e != 9 {
+		t.Errorf("Error in MaxEpoch(), expected 9, got %v", e)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	defer SetCoordinator(false)
+
+	seen := GetEpoch() + 10
+	Observe(seen)
+	Observe(seen - 5) // an older epoch doesn't lower the highest seen
+	if e := NewBeat().Epoch; e != seen {
+		t.Errorf("Error in NewBeat(), expected a non-Coordinator to advertise epoch %v, got %v", seen, e)
+	}
+	SetCoordinator(true)
+	if e := Acquire(0); e != seen+1 {
+		t.Errorf("Error in Acquire(), expected epoch %v above any seen, got %v", seen+1, e)
+	}
+	if e := NewBeat().Epoch; e != seen+1 {
+		t.Errorf("Error in NewBeat(), expected the Coordinator to advertise its own epoch %v, got %v", seen+1, e)
+	}
+	Release()
+}
+
+func TestWinner(t *testing.T) {
+	tables := []struct {
+		description string
+		beats       Beats
+		winner      int64
+	}{
+		{"latest lease wins over rank", Beats{
+			{Node: node1, Coordinator: true, Epoch: 4, Priority: 10},
+			{Node: node2, Coordinator: true, Epoch: 5},
+		}, node2.ID},
+		{"equal leases fall back to rank", Beats{
+			{Node: node1, Coordinator: true, Epoch: 5},
+			{Node: node2, Coordinator: true, Epoch: 5},
+		}, node1.ID},
+		{"only Coordinators are considered", Beats{
+			{Node: node1, Feasible: true, Epoch: 9},
+			{Node: node2, Coordinator: true, Epoch: 1},
+		}, node2.ID},
+	}
+	for _, table := range tables {
+		if w, ok := table.beats.Winner(); !ok || w.ID != table.winner {
+			t.Errorf("Error in Winner() for case %q, expected %v, got %v", table.description, table.winner, w.ID)
+		}
+	}
+	if _, ok := (Beats{{Node: node1}}).Winner(); ok {
+		t.Errorf("Error in Winner(), expected no winner without a Coordinator")
+	}
+}
@@ -0,0 +1,118 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// TimingConfig holds the intervals that decide how quickly the cluster notices failures, in seconds. They depend on
+// each other, so they're validated together, and every node in a cluster should use the same values.
+type TimingConfig struct {
+	CoordinatorInterval int `json:"coordinator-interval"` // between Beats from the Coordinator and Feasible Coordinator
+	NodeInterval        int `json:"node-interval"`        // between Beats from every other node
+	AgeOut              int `json:"age-out"`              // silence before a node is forgotten
+	Lease               int `json:"lease"`                // Coordinator lease duration, see Acquire
+	ConsensusWindow     int `json:"consensus-window"`     // shortest time a status counts towards consensus
+	RoutineInterval     int `json:"routine-interval"`     // between RoutineNormal reports from idle routines
+	RoutineTimeout      int `json:"routine-timeout"`      // silence before a routine is considered dead
+}
+
+// Timing is the cluster's current timing configuration.
+var Timing = TimingConfig{
+	CoordinatorInterval: 5,
+	NodeInterval:        30,
+	AgeOut:              35,
+	Lease:               15,
+	ConsensusWindow:     60,
+	RoutineInterval:     15,
+	RoutineTimeout:      120,
+}
+
+func (t TimingConfig) validate() error {
+	for name, v := range map[string]int{
+		"coordinator-interval": t.CoordinatorInterval,
+		"node-interval":        t.NodeInterval,
+		"age-out":              t.AgeOut,
+		"lease":                t.Lease,
+		"consensus-window":     t.ConsensusWindow,
+		"routine-interval":     t.RoutineInterval,
+		"routine-timeout":      t.RoutineTimeout,
+	} {
+		if v <= 0 {
+			return errors.Errorf("%v must be positive", name)
+		}
+	}
+	switch {
+	case t.CoordinatorInterval > t.NodeInterval:
+		return errors.New("coordinator-interval must not exceed node-interval")
+	// Otherwise ordinary nodes are forgotten between their own Beats
+	case t.AgeOut <= t.NodeInterval:
+		return errors.New("age-out must exceed node-interval")
+	// Otherwise the Coordinator's lease lapses between renewals
+	case t.Lease <= t.CoordinatorInterval:
+		return errors.New("lease must exceed coordinator-interval")
+	// Otherwise a paused Coordinator could still hold its lease when a replacement is elected
+	case t.Lease >= t.AgeOut:
+		return errors.New("lease must be shorter than age-out")
+	}
+	// Each routine reports at least once per one of these intervals, so the timeout must allow for the longest
+	for name, v := range map[string]int{
+		"node-interval":    t.NodeInterval,
+		"routine-interval": t.RoutineInterval,
+	} {
+		if t.RoutineTimeout <= v {
+			return errors.Errorf("routine-timeout must exceed %v", name)
+		}
+	}
+	return nil
+}
+
+// Configure parses and validates the cluster timing configuration, which may be nil if none was provided. Values that
+// aren't given keep their defaults.
+func Configure(config *json.RawMessage) error {
+	t := Timing
+	if config != nil {
+		if err := json.Unmarshal(*config, &t); err != nil {
+			return errors.Wrap(err, "could not parse cluster configuration")
+		}
+	}
+	if err := t.validate(); err != nil {
+		return errors.Wrap(err, "invalid cluster configuration")
+	}
+	Timing = t
+	return nil
+}
+
+func seconds(s int) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// BeatInterval returns how often this node sends a Beat and evaluates the election, which is more often while it holds
+// the Coordinator or Feasible Coordinator role.
+func BeatInterval() time.Duration {
+	if GetCoordinator() || feasibleCoordinator {
+		return seconds(Timing.CoordinatorInterval)
+	}
+	return seconds(Timing.NodeInterval)
+}
+
+// AgeOutAfter returns how long a node may be silent before it's forgotten.
+func AgeOutAfter() time.Duration {
+	return seconds(Timing.AgeOut)
+}
+
+// ConsensusWindow returns the shortest time a status counts towards consensus.
+func ConsensusWindow() time.Duration {
+	return seconds(Timing.ConsensusWindow)
+}
+
+// RoutineInterval returns how often an otherwise idle routine reports that it's healthy.
+func RoutineInterval() time.Duration {
+	return seconds(Timing.RoutineInterval)
+}
+
+// RoutineTimeout returns how long a routine may go without reporting before it's considered dead.
+func RoutineTimeout() time.Duration {
+	return seconds(Timing.RoutineTimeout)
+}
@@ -0,0 +1,39 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfigure(t *testing.T) {
+	defaults := Timing
+	defer func() { Timing = defaults }()
+
+	tables := []struct {
+		description string
+		config      string
+		valid       bool
+	}{
+		{"defaults", `{}`, true},
+		{"faster cluster", `{"coordinator-interval": 2, "node-interval": 10, "age-out": 15, "lease": 6}`, true},
+		{"age-out within node-interval", `{"node-interval": 30, "age-out": 21}`, false},
+		{"lease outlasts age-out", `{"lease": 40}`, false},
+		{"lease lapses between renewals", `{"lease": 5}`, false},
+		{"coordinator slower than nodes", `{"coordinator-interval": 31}`, false},
+		{"routine timeout within routine interval", `{"routine-interval": 120}`, false},
+		{"zero interval", `{"routine-interval": 0}`, false},
+		{"not an object", `[]`, false},
+	}
+	for _, table := range tables {
+		Timing = defaults
+		raw := json.RawMessage(table.config)
+		if err := Configure(&raw); (err == nil) != table.valid {
+			t.Errorf("Error in Configure() for case %q, expected valid %v, got %v", table.description, table.valid, err)
+		}
+	}
+
+	Timing = defaults
+	if err := Configure(nil); err != nil || Timing != defaults {
+		t.Errorf("Error in Configure() without configuration, expected defaults, got %+v, %v", Timing, err)
+	}
+}
@@ -2,11 +2,11 @@ package amqp
 
 import (
 	"encoding/json"
-	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/alowde/dpoller/heartbeat"
 	"github.com/alowde/dpoller/listen"
 	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/pkg/amqpconf"
 	"github.com/alowde/dpoller/url/check"
 	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
@@ -16,24 +16,21 @@ var log *logrus.Entry
 
 // Config contains all data used to connect to an AMQP broker.
 type Config struct {
-	Host     string `json:"host"`
-	User     string `json:"user"`
-	Pass     string `json:"pass"`
-	Scheme   string `json:"scheme"`
-	Port     int    `json:"port"`
-	Exchange string `json:"exchange"` // exchange name
-	Channel  string `json:"channel"`  // channel name
+	amqpconf.Config
+	Brokers  amqpconf.Brokers `json:"brokers"`  // tried in order, instead of the single broker fields
+	Exchange string           `json:"exchange"` // exchange name
+	Channel  string           `json:"channel"`  // channel name
 }
 
-func (c Config) validate() error {
-	if len(c.Host) <= 0 {
-		return fmt.Errorf("invalid host field")
+func (c *Config) validate() error {
+	if len(c.Brokers) == 0 {
+		c.Brokers = amqpconf.Brokers{c.Config}
 	}
-	if len(c.User) <= 0 {
-		return fmt.Errorf("invalid user field")
+	if err := c.Brokers.Validate(); err != nil {
+		return err
 	}
-	if len(c.Pass) <= 0 {
-		return fmt.Errorf("invalid pass field")
+	if c.Exchange == "" {
+		return errors.New("missing exchange field")
 	}
 	return nil
 }
@@ -45,12 +42,12 @@ func initialise(config json.RawMessage, ll logrus.Level) (result chan error, hch
 	log = logger.New("amqpListen", ll)
 
 	log.Debug("Initialising AMQP listener")
-	brokerInstance, err = newBroker(config)
+	b, err := newBroker(config)
 	if err != nil {
 		return nil, nil, nil, errors.Wrap(err, "could not initialise listener")
 	}
 	// Connecting here helps detect issues early
-	if err := brokerInstance.connect(); err != nil {
+	if err := b.connect(); err != nil {
 		return nil, nil, nil, errors.Wrap(err, "error while connecting listener")
 	}
 
@@ -58,7 +55,7 @@ func initialise(config json.RawMessage, ll logrus.Level) (result chan error, hch
 	hchan = make(chan heartbeat.Beat)
 	schan = make(chan check.Status)
 
-	if err := brokerInstance.listen(result, hchan, schan); err != nil {
+	if err := b.listen(result, hchan, schan); err != nil {
 		return nil, nil, nil, errors.Wrap(err, "error while calling listen function")
 	}
 	log.Debug("Completed AMQP listener configuration")
@@ -85,13 +82,9 @@ func newBroker(config []byte) (*broker, error) {
 		return &b, errors.Wrap(err, "could not validate config")
 	}
 	b.Config = c
-	b.closed = make(chan *amqp.Error)
-	close(b.closed)
 	return &b, nil
 }
 
-var brokerInstance *broker
-
 func init() {
 	listen.RegisterConfigFunction("amqp", initialise)
 }
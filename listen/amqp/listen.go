@@ -1,10 +1,11 @@
 package amqp
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
 	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/pkg/amqpconf"
 	"github.com/alowde/dpoller/url/check"
 	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
@@ -14,19 +15,17 @@ import (
 // connect establishes connection for AMQP broker.
 func (b *broker) connect() error {
 	var err error
-	uri := fmt.Sprintf(
-		"%v://%v:%v@%v:%v/",
-		b.Scheme,
-		b.User,
-		b.Pass,
-		b.Host,
-		b.Port,
-	)
-	if b.connection, err = amqp.Dial(uri); err != nil {
+	var c amqpconf.Config
+	if b.connection, c, err = b.Brokers.Dial(); err != nil {
 		return errors.Wrap(err, "could not connect to AMQP broker")
 	}
+	if c != b.Brokers[0] {
+		log.WithField("url", c.Redacted()).Warn("failed over to a backup AMQP broker")
+	}
 
-	b.closed = make(chan *amqp.Error)
+	// The library won't close our deliveries until it has told us why the connection closed, so there must always be
+	// room for the reason even while we're busy with a message
+	b.closed = make(chan *amqp.Error, 1)
 	b.connection.NotifyClose(b.closed)
 
 	if b.achannel, err = b.connection.Channel(); err != nil {
@@ -48,104 +47,127 @@ func (b *broker) connect() error {
 	return nil
 }
 
-// listen ensures the connection is live and sets up a parsing routine.
+// listen subscribes to the exchange and sets up a parsing routine.
 func (b *broker) listen(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) error {
-	// loop until either the broker connection is not closed or an attempt to open the connection fails
+	inbox, err := b.subscribe()
+	if err != nil {
+		return err
+	}
+	go b.parseAmqpMessages(inbox, result, hchan, schan)
+	return nil
+}
+
+// subscribe declares a queue bound to the exchange and starts consuming from it. The queue is deleted by the broker
+// when we disconnect, so this must be repeated after every reconnection.
+func (b *broker) subscribe() (<-chan amqp.Delivery, error) {
+	// declare a queue on the AMQP broker
+	queue, err := b.achannel.QueueDeclare(
+		"",    // Ask server to generate a name
+		false, // durable
+		true,  // delete when unused
+		false, // exclusive
+		false, // noWait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to declare an AMQP queue")
+	}
+	// bind that queue to the dpoller exchange
+	if err = b.achannel.QueueBind(
+		queue.Name, // name of the queue
+		"#",        // bindingKey
+		b.Exchange, // sourceExchange
+		false,      // noWait
+		nil,        // arguments
+	); err != nil {
+		return nil, errors.Wrap(err, "unable to bind to AMQP queue")
+	}
+	// receive AMQP messages on a new Go channel
+	inbox, err := b.achannel.Consume(
+		queue.Name, // name
+		"",         // auto generated consumerTag,
+		false,      // no auto acknowledgements
+		true,       // exclusive
+		false,      // option not supported
+		false,      // receive deliveries immediately
+		nil,        // arguments
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to consume from AMQP queue")
+	}
+	return inbox, nil
+}
+
+// reconnect retries connecting and subscribing with exponential backoff until it succeeds. Failed attempts aren't
+// reported: the listener stops reporting normal while it's reconnecting, so a brief outage such as a broker restart
+// goes unnoticed and the watchdog decides when one has gone on too long.
+func (b *broker) reconnect() <-chan amqp.Delivery {
+	wait := time.Second
 	for {
-		select {
-		case <-b.closed:
-			if err := b.connect(); err != nil {
-				return errors.Wrap(err, "could not connect before listening")
-			}
-		default:
-			// declare a queue on the AMQP broker
-			queue, err := b.achannel.QueueDeclare(
-				"",    // Ask server to generate a name
-				false, // durable
-				true,  // delete when unused
-				false, // exclusive
-				false, // noWait
-				nil,   // arguments
-			)
-			if err != nil {
-				return errors.Wrap(err, "unable to declare an AMQP queue")
-			}
-			// bind that queue to the dpoller exchange
-			if err = b.achannel.QueueBind(
-				queue.Name, // name of the queue
-				"#",        // bindingKey
-				b.Exchange, // sourceExchange
-				false,      // noWait
-				nil,        // arguments
-			); err != nil {
-				return errors.Wrap(err, "unable to bind to AMQP queue")
-			}
-			// receive AMQP messages on a new Go channel
-			inbox, err := b.achannel.Consume(
-				queue.Name, // name
-				"",         // auto generated consumerTag,
-				false,      // no auto acknowledgements
-				true,       // exclusive
-				false,      // option not supported
-				false,      // receive deliveries immediately
-				nil,        // arguments
-			)
-			if err != nil {
-				return errors.Wrap(err, "unable to consume from AMQP queue")
+		err := b.connect()
+		if err == nil {
+			var inbox <-chan amqp.Delivery
+			if inbox, err = b.subscribe(); err == nil {
+				log.Info("reconnected to AMQP broker")
+				return inbox
 			}
-			// launch the actual parsing routine
-			go parseAmqpMessages(inbox, result, hchan, schan)
-			return nil
+			_ = b.connection.Close()
+		}
+		log.WithError(err).WithField("retry in", wait).Warn("could not reconnect to AMQP broker")
+		time.Sleep(wait)
+		if wait *= 2; wait > time.Minute {
+			wait = time.Minute
 		}
 	}
 }
 
-func parseAmqpMessages(inbox <-chan amqp.Delivery, result chan error, hchan chan heartbeat.Beat, schan chan check.Status) {
+func (b *broker) parseAmqpMessages(inbox <-chan amqp.Delivery, result chan error, hchan chan heartbeat.Beat, schan chan check.Status) {
+	heartbeatTimer := time.NewTicker(heartbeat.RoutineInterval())
 	for {
-		heartbeatTimer := time.NewTicker(15 * time.Second)
-	loop:
-		for {
-			select {
-			case <-heartbeatTimer.C:
-				result <- heartbeat.RoutineNormal{Timestamp: time.Now()}
-				continue loop
-			case message := <-inbox:
-				_ = message.Ack(true) // If Ack fails it'll still be easier to deal with elsewhere.
-				switch message.Type {
-				case "status":
-					var s check.Status
-					if err := json.Unmarshal(message.Body, &s); err != nil {
-						log.WithFields(logrus.Fields{
-							"error":    err,
-							"delivery": fmt.Sprintf("%#v", message),
-						}).Warn("failed to decode a Status delivery, skipping")
-						continue
-					}
-					log.Info("received a Status")
-					log.WithFields(logrus.Fields{
-						"status": fmt.Sprintf("%#v", s),
-					}).Debug("decoded a Status")
-					schan <- s
-				case "heartbeat":
-					var b heartbeat.Beat
-					if err := json.Unmarshal(message.Body, &b); err != nil {
-						log.WithFields(logrus.Fields{
-							"error":    err,
-							"delivery": fmt.Sprintf("%#v", message),
-						}).Warn("failed to decode a Heartbeat delivery, skipping")
-						continue
-					}
-					log.Info("received a Heartbeat")
-					log.WithFields(logrus.Fields{
-						"beat": fmt.Sprintf("%#v", b),
-					}).Debug("decoded a Heartbeat")
-					hchan <- b
+		select {
+		case <-heartbeatTimer.C:
+			result <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+		case reason := <-b.closed:
+			log.WithField("reason", reason).Warn("AMQP connection closed, reconnecting")
+			inbox = b.reconnect()
+		case message, ok := <-inbox:
+			if !ok {
+				select {
+				case reason := <-b.closed:
+					log.WithField("reason", reason).Warn("AMQP connection closed, reconnecting")
 				default:
-					log.WithFields(logrus.Fields{
-						"type": message.Type,
-					}).Warn("received unknown delivery type")
+					// Only the channel closed, so make sure the connection doesn't leak
+					log.Warn("AMQP channel closed, reconnecting")
+					_ = b.connection.Close()
 				}
-
+				inbox = b.reconnect()
+				continue
+			}
+			_ = message.Ack(true) // If Ack fails it'll still be easier to deal with elsewhere.
+			v, err := envelope.OpenTyped(message.Body, message.Type)
+			if err != nil {
+				if envelope.Duplicate(err) {
+					continue // already received over another path
+				}
+				log.WithFields(logrus.Fields{
+					"error": err,
+					"type":  message.Type,
+				}).Warn("dropped a delivery")
+				continue
+			}
+			switch m := v.(type) {
+			case check.Status:
+				log.Info("received a Status")
+				log.WithFields(logrus.Fields{
+					"status": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Status")
+				schan <- m
+			case heartbeat.Beat:
+				log.Info("received a Heartbeat")
+				log.WithFields(logrus.Fields{
+					"beat": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Heartbeat")
+				hchan <- m
 			}
 		}
 	}
@@ -0,0 +1,183 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/url/check"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeBroker speaks just enough AMQP 0-9-1 for the listener to connect and start consuming, and can close a
+// connection from the server side the way a broker does when it's shutting down.
+type fakeBroker struct {
+	listener  net.Listener
+	consuming chan net.Conn // receives each connection once it's consuming
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	f := &fakeBroker{consuming: make(chan net.Conn, 10)}
+	f.start(t, "127.0.0.1:0")
+	return f
+}
+
+// start accepts connections on the given address.
+func (f *fakeBroker) start(t *testing.T, addr string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("could not start fake AMQP broker: %v", err)
+	}
+	f.listener = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+}
+
+// method builds the arguments of a method frame.
+type method struct{ bytes.Buffer }
+
+func (m *method) short(v uint16) *method { _ = binary.Write(m, binary.BigEndian, v); return m }
+func (m *method) long(v uint32) *method  { _ = binary.Write(m, binary.BigEndian, v); return m }
+func (m *method) shortstr(s string) *method {
+	m.WriteByte(byte(len(s)))
+	m.WriteString(s)
+	return m
+}
+func (m *method) longstr(s string) *method {
+	m.long(uint32(len(s)))
+	m.WriteString(s)
+	return m
+}
+
+func send(w io.Writer, channel, class, id uint16, args *method) {
+	var payload method
+	payload.short(class).short(id)
+	if args != nil {
+		payload.Write(args.Bytes())
+	}
+	var frame method
+	frame.WriteByte(1) // method frame
+	frame.short(channel).long(uint32(payload.Len()))
+	frame.Write(payload.Bytes())
+	frame.WriteByte(0xCE) // frame end
+	_, _ = w.Write(frame.Bytes())
+}
+
+func (f *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	if _, err := io.ReadFull(conn, make([]byte, 8)); err != nil { // protocol header
+		return
+	}
+	// connection.start for version 0-9 with no server properties
+	send(conn, 0, 10, 10, (&method{}).short(0x0009).long(0).longstr("PLAIN").longstr("en_US"))
+
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		channel := binary.BigEndian.Uint16(header[1:3])
+		payload := make([]byte, binary.BigEndian.Uint32(header[3:7])+1)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		if header[0] != 1 {
+			continue // client heartbeats
+		}
+		switch [2]uint16{binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])} {
+		case [2]uint16{10, 11}: // connection.start-ok
+			send(conn, 0, 10, 30, (&method{}).short(0).long(131072).short(0))
+		case [2]uint16{10, 40}: // connection.open
+			send(conn, 0, 10, 41, (&method{}).shortstr(""))
+		case [2]uint16{10, 50}: // connection.close
+			send(conn, 0, 10, 51, nil)
+			return
+		case [2]uint16{10, 51}: // connection.close-ok
+			return
+		case [2]uint16{20, 10}: // channel.open
+			send(conn, channel, 20, 11, (&method{}).longstr(""))
+		case [2]uint16{20, 40}: // channel.close
+			send(conn, channel, 20, 41, nil)
+		case [2]uint16{40, 10}: // exchange.declare
+			send(conn, channel, 40, 11, nil)
+		case [2]uint16{50, 10}: // queue.declare
+			send(conn, channel, 50, 11, (&method{}).shortstr("amq.gen-test").long(0).long(0))
+		case [2]uint16{50, 20}: // queue.bind
+			send(conn, channel, 50, 21, nil)
+		case [2]uint16{60, 20}: // basic.consume, echo the consumer tag after the reserved short and queue name
+			queue := int(payload[6])
+			tag := string(payload[8+queue : 8+queue+int(payload[7+queue])])
+			send(conn, channel, 60, 21, (&method{}).shortstr(tag))
+			f.consuming <- conn
+		}
+	}
+}
+
+// shutdown closes a connection from the broker's side, as a broker does when it's stopped.
+func (f *fakeBroker) shutdown(conn net.Conn) {
+	send(conn, 0, 10, 50, (&method{}).short(320).shortstr("CONNECTION_FORCED - broker shutting down").short(0).short(0))
+}
+
+func (f *fakeBroker) waitConsuming(t *testing.T) net.Conn {
+	select {
+	case conn := <-f.consuming:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the listener to consume")
+	}
+	return nil
+}
+
+// TestServerClose closes the listener's connection from the broker, then restarts the broker after a few seconds. The
+// listener should reconnect both times without reporting the brief outage as a failure.
+func TestServerClose(t *testing.T) {
+	log = logger.New("amqpListen", logrus.FatalLevel)
+	f := newFakeBroker(t)
+	defer f.listener.Close()
+
+	port := f.listener.Addr().(*net.TCPAddr).Port
+	conf := fmt.Sprintf(`{"host": "127.0.0.1", "port": %v, "user": "guest", "pass": "guest", "exchange": "test"}`, port)
+	b, err := newBroker(json.RawMessage(conf))
+	if err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	if err := b.connect(); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	result := make(chan error, 10)
+	if err := b.listen(result, make(chan heartbeat.Beat), make(chan check.Status)); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+
+	f.shutdown(f.waitConsuming(t))
+	conn := f.waitConsuming(t)
+
+	// Several reconnection attempts fail while the broker restarts
+	addr := f.listener.Addr().String()
+	f.listener.Close()
+	f.shutdown(conn)
+	time.Sleep(2500 * time.Millisecond)
+	f.start(t, addr)
+	f.waitConsuming(t)
+
+	for len(result) > 0 {
+		if err := <-result; err != nil {
+			if _, ok := err.(heartbeat.RoutineNormal); !ok {
+				t.Errorf("Error in reconnect(), reported %v during a brief outage", err)
+			}
+		}
+	}
+}
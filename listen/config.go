@@ -11,6 +11,7 @@ import (
 	"github.com/alowde/dpoller/logger"
 	"github.com/alowde/dpoller/url/check"
 	"github.com/pkg/errors"
+	"strings"
 )
 
 var log *logrus.Entry
@@ -18,7 +19,8 @@ var log *logrus.Entry
 type configParseFunction func(message json.RawMessage, ll logrus.Level) (watchdog chan error, hchan chan heartbeat.Beat, schan chan check.Status, err error)
 
 // RegisterConfigFunction is called as a side-effect of importing a listener module. It accepts a lambda that will have
-// all related configuration passed to it.
+// all related configuration passed to it. A module may be configured more than once using keys of the form
+// "<name>:<instance>", e.g. "amqp:backup", and the lambda is called once for each.
 func RegisterConfigFunction(name string, f configParseFunction) {
 	configParseFunctions[name] = f
 }
@@ -43,31 +45,30 @@ func Initialise(config json.RawMessage, ll logrus.Level) (watchdog chan error, h
 	}
 
 	// Iterate over configs received and pass them to registered modules
-	var hasOkListener bool
-	for listenerName, rawConfig := range C {
+	var configured = make(map[string]bool)
+	var watchdogs []chan error
+	for key, rawConfig := range C {
 
 		// If we don't have any listener plugins by this name then skip it
-		if _, ok := configParseFunctions[listenerName]; !ok {
-			log.WithField("config name", listenerName).
+		listenerName := strings.SplitN(key, ":", 2)[0]
+		f, ok := configParseFunctions[listenerName]
+		if !ok {
+			log.WithField("config name", key).
 				Warn("Found unused listener config")
 			continue
 		}
 
 		// Call the provided configuration function and link the received channels to our aggregate channel
-		log.WithField("name", listenerName).
+		log.WithField("name", key).
 			Debug("Configuring listener module")
-		w, h, s, err := configParseFunctions[listenerName](rawConfig, ll)
+		w, h, s, err := f(rawConfig, ll)
 		if err != nil {
-			log.WithField("name", listenerName).
+			log.WithField("name", key).
 				WithField("received error", err).
 				Warn("Received an error while providing configuration to listener module")
 			continue
 		}
-		go func(in, out chan error) {
-			for {
-				out <- <-in
-			}
-		}(w, watchdog)
+		watchdogs = append(watchdogs, w)
 		go func(in, out chan heartbeat.Beat) {
 			for {
 				out <- <-in
@@ -78,17 +79,32 @@ func Initialise(config json.RawMessage, ll logrus.Level) (watchdog chan error, h
 				out <- <-in
 			}
 		}(s, schan)
-		hasOkListener = true
-		delete(configParseFunctions, listenerName)
+		configured[listenerName] = true
+	}
+
+	// With more than one listener, each is a redundant path to the rest of the cluster. One failing is logged rather
+	// than passed on, and the routine only times out once none of them are healthy.
+	for _, w := range watchdogs {
+		go func(in, out chan error, redundant bool) {
+			for err := range in {
+				if _, ok := err.(heartbeat.RoutineNormal); !ok && redundant {
+					log.WithError(err).Warn("A listener failed, continuing with the others")
+					continue
+				}
+				out <- err
+			}
+		}(w, watchdog, len(watchdogs) > 1)
 	}
 
 	// Any configuration functions left haven't been successfully initialised
 	for listenerName := range configParseFunctions {
-		log.WithField("listener name", listenerName).
-			Warn("Listener module found no config")
+		if !configured[listenerName] {
+			log.WithField("listener name", listenerName).
+				Warn("Listener module found no config")
+		}
 	}
-	if hasOkListener {
-		log.Debug("Configured listeners")
+	if len(watchdogs) > 0 {
+		log.WithField("listeners", len(watchdogs)).Debug("Configured listeners")
 		return watchdog, hchan, schan, nil
 	}
 	return nil, nil, nil, errors.New("No configuration matched listener modules")
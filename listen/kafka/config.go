@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/listen"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/pkg/tlsconf"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"os"
+)
+
+var log *logrus.Entry
+
+// Config contains all data used to consume from a Kafka cluster.
+type Config struct {
+	Brokers        []string       `json:"brokers"`         // host:port of one or more bootstrap brokers
+	Version        string         `json:"version"`         // Kafka protocol version, e.g. "2.1.0"
+	StatusTopic    string         `json:"status-topic"`    // topic for statuses
+	HeartbeatTopic string         `json:"heartbeat-topic"` // topic for heartbeats
+	GroupID        string         `json:"group-id"`        // consumer group, must be unique to this node
+	MaxAge         int            `json:"max-age"`         // seconds after which a message is too stale to use
+	TLS            tlsconf.Config `json:"tls"`
+}
+
+func (c *Config) validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("missing brokers field")
+	}
+	if c.Version == "" {
+		c.Version = "2.1.0"
+	}
+	if c.StatusTopic == "" {
+		c.StatusTopic = "dpoller-status"
+	}
+	if c.HeartbeatTopic == "" {
+		c.HeartbeatTopic = "dpoller-heartbeat"
+	}
+	// Every node must see every message, so each node needs a consumer group of its own. The host name is stable
+	// across restarts, which lets a restarted node resume from its committed offsets.
+	if c.GroupID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "missing group-id field and could not determine host name")
+		}
+		c.GroupID = "dpoller-" + host
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = 60
+	}
+	return nil
+}
+
+// initialise turns the provided config []byte into a validated consumer, generates the listen channels and starts
+// consuming the dpoller topics.
+func initialise(config json.RawMessage, ll logrus.Level) (result chan error, hchan chan heartbeat.Beat, schan chan check.Status, err error) {
+
+	log = logger.New("kafkaListen", ll)
+
+	log.Debug("Initialising Kafka listener")
+	var c Config
+	if err := json.Unmarshal(config, &c); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "unable to parse Kafka config")
+	}
+	if err := c.validate(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "could not validate config")
+	}
+	k := &consumer{Config: c}
+	if err := k.connect(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error while connecting listener")
+	}
+
+	result = make(chan error, 10)
+	hchan = make(chan heartbeat.Beat)
+	schan = make(chan check.Status)
+
+	k.listen(result, hchan, schan)
+	log.WithField("group", c.GroupID).Debug("Completed Kafka listener configuration")
+	return result, hchan, schan, nil
+}
+
+func init() {
+	listen.RegisterConfigFunction("kafka", initialise)
+}
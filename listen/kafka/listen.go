@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"sync/atomic"
+	"time"
+)
+
+// consumer is an active member of a Kafka consumer group.
+type consumer struct {
+	Config
+	group  sarama.ConsumerGroup
+	inbox  chan *sarama.ConsumerMessage
+	active int32 // set while the consumer holds a group session
+}
+
+// connect joins the consumer group. New groups start from the newest offset as older messages would be stale.
+func (k *consumer) connect() error {
+	version, err := sarama.ParseKafkaVersion(k.Version)
+	if err != nil {
+		return errors.Wrap(err, "invalid version")
+	}
+	c := sarama.NewConfig()
+	c.ClientID = "dpoller"
+	c.Version = version
+	c.Consumer.Offsets.Initial = sarama.OffsetNewest
+	c.Consumer.Return.Errors = true
+	if k.TLS.Enabled() {
+		c.Net.TLS.Enable = true
+		if c.Net.TLS.Config, err = k.TLS.Build(); err != nil {
+			return errors.Wrap(err, "invalid TLS configuration")
+		}
+	}
+	if k.group, err = sarama.NewConsumerGroup(k.Brokers, k.GroupID, c); err != nil {
+		return errors.Wrap(err, "could not join Kafka consumer group")
+	}
+	return nil
+}
+
+// listen starts consuming and sets up a parsing routine.
+func (k *consumer) listen(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) {
+	k.inbox = make(chan *sarama.ConsumerMessage, 64)
+	go func() {
+		for err := range k.group.Errors() {
+			log.WithError(err).Warn("received error from Kafka consumer group")
+		}
+	}()
+	go func() {
+		// Consume returns whenever the group rebalances, so it's called in a loop to rejoin
+		for {
+			if err := k.group.Consume(context.Background(), []string{k.StatusTopic, k.HeartbeatTopic}, k); err != nil {
+				log.WithError(err).Warn("Kafka consumer group session ended, rejoining")
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+	go k.parseKafkaMessages(result, hchan, schan)
+}
+
+// Setup satisfies sarama.ConsumerGroupHandler and marks the consumer active.
+func (k *consumer) Setup(sarama.ConsumerGroupSession) error {
+	atomic.StoreInt32(&k.active, 1)
+	return nil
+}
+
+// Cleanup satisfies sarama.ConsumerGroupHandler and marks the consumer inactive.
+func (k *consumer) Cleanup(sarama.ConsumerGroupSession) error {
+	atomic.StoreInt32(&k.active, 0)
+	return nil
+}
+
+// ConsumeClaim satisfies sarama.ConsumerGroupHandler, passing each message on for parsing and marking it consumed.
+func (k *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for m := range claim.Messages() {
+		k.inbox <- m
+		session.MarkMessage(m, "")
+	}
+	return nil
+}
+
+func (k *consumer) parseKafkaMessages(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) {
+	heartbeatTimer := time.NewTicker(heartbeat.RoutineInterval())
+	defer heartbeatTimer.Stop()
+	for {
+		select {
+		case <-heartbeatTimer.C:
+			// Between group sessions we stay quiet and let the watchdog decide if it's taken too long to rejoin
+			if atomic.LoadInt32(&k.active) == 0 {
+				log.Warn("not currently a member of the Kafka consumer group")
+				continue
+			}
+			result <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+		case message := <-k.inbox:
+			// A node resuming from its committed offsets may be handed a backlog that's no longer relevant
+			if time.Since(message.Timestamp) > time.Duration(k.MaxAge)*time.Second {
+				log.WithField("topic", message.Topic).Debug("skipping stale message")
+				continue
+			}
+			v, err := envelope.Open(message.Value)
+			if err != nil {
+				if envelope.Duplicate(err) {
+					continue // already received over another path
+				}
+				log.WithFields(logrus.Fields{
+					"error": err,
+					"topic": message.Topic,
+				}).Warn("dropped a message")
+				continue
+			}
+			switch m := v.(type) {
+			case check.Status:
+				log.Info("received a Status")
+				log.WithFields(logrus.Fields{
+					"status": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Status")
+				schan <- m
+			case heartbeat.Beat:
+				log.Info("received a Heartbeat")
+				log.WithFields(logrus.Fields{
+					"beat": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Heartbeat")
+				hchan <- m
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/listen"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/pkg/tlsconf"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+)
+
+var log *logrus.Entry
+
+// Config contains all data used to connect to an MQTT broker.
+type Config struct {
+	URL         string         `json:"url"`          // e.g. tcp://host:1883 or ssl://host:8883
+	User        string         `json:"user"`         // optional username
+	Pass        string         `json:"pass"`         // optional password
+	ClientID    string         `json:"client-id"`    // defaults to a name derived from the node ID
+	TopicPrefix string         `json:"topic-prefix"` // messages are received from below <prefix>/
+	QoS         byte           `json:"qos"`          // 0, 1 or 2
+	TLS         tlsconf.Config `json:"tls"`
+}
+
+func (c *Config) validate() error {
+	if c.URL == "" {
+		return errors.New("missing url field")
+	}
+	if c.QoS > 2 {
+		return errors.New("qos must be 0, 1 or 2")
+	}
+	if c.TopicPrefix == "" {
+		c.TopicPrefix = "dpoller"
+	}
+	if c.ClientID == "" {
+		c.ClientID = fmt.Sprintf("dpoller-sub-%x", node.Self.ID)
+	}
+	return nil
+}
+
+// initialise turns the provided config []byte into a validated broker, generates the listen channels and subscribes
+// to the dpoller topics.
+func initialise(config json.RawMessage, ll logrus.Level) (result chan error, hchan chan heartbeat.Beat, schan chan check.Status, err error) {
+
+	log = logger.New("mqttListen", ll)
+
+	log.Debug("Initialising MQTT listener")
+	var c Config
+	if err := json.Unmarshal(config, &c); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "unable to parse MQTT config")
+	}
+	if err := c.validate(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "could not validate config")
+	}
+
+	b := &broker{Config: c}
+	result = make(chan error, 10)
+	hchan = make(chan heartbeat.Beat)
+	schan = make(chan check.Status)
+
+	// Subscriptions are made when the connection is established, so connecting is the last step
+	if err := b.connect(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error while connecting listener")
+	}
+	go b.parseMqttMessages(result, hchan, schan)
+	log.Debug("Completed MQTT listener configuration")
+	return result, hchan, schan, nil
+}
+
+func init() {
+	listen.RegisterConfigFunction("mqtt", initialise)
+}
@@ -0,0 +1,154 @@
+package mqtt
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// broker is an active connection to an MQTT broker.
+type broker struct {
+	Config
+	client mqtt.Client
+	inbox  chan mqtt.Message
+}
+
+// connect establishes a connection to the MQTT broker. Subscriptions are made from the connection handler so they're
+// restored whenever the client reconnects.
+func (b *broker) connect() error {
+	b.inbox = make(chan mqtt.Message, 64)
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.URL).
+		SetClientID(b.ClientID).
+		SetProtocolVersion(4). // MQTT 3.1.1
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(b.subscribe).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.WithError(err).Warn("lost connection to MQTT broker")
+		})
+	if b.User != "" {
+		opts.SetUsername(b.User)
+		opts.SetPassword(b.Pass)
+	}
+	if b.TLS.Enabled() {
+		t, err := b.TLS.Build()
+		if err != nil {
+			return errors.Wrap(err, "invalid TLS configuration")
+		}
+		opts.SetTLSConfig(t)
+	}
+	b.client = mqtt.NewClient(opts)
+	token := b.client.Connect()
+	if !token.WaitTimeout(30 * time.Second) {
+		return errors.New("timed out connecting to MQTT broker")
+	}
+	if err := token.Error(); err != nil {
+		return errors.Wrap(err, "could not connect to MQTT broker")
+	}
+	return nil
+}
+
+// heartbeatTopics is the prefix of every node's heartbeat topic.
+func (b *broker) heartbeatTopics() string {
+	return b.TopicPrefix + "/heartbeat/"
+}
+
+// subscribe requests statuses and every node's heartbeat topic, including those retained by the broker.
+func (b *broker) subscribe(c mqtt.Client) {
+	topics := map[string]byte{
+		b.TopicPrefix + "/status": b.QoS,
+		b.heartbeatTopics() + "+": b.QoS,
+	}
+	token := c.SubscribeMultiple(topics, func(_ mqtt.Client, m mqtt.Message) {
+		b.inbox <- m
+	})
+	if token.Wait() && token.Error() != nil {
+		log.WithError(token.Error()).Warn("unable to subscribe to MQTT topics")
+	}
+}
+
+// open authenticates a message. Heartbeat topics carry the last wills of departed nodes, which may have been sealed
+// long before they're delivered. Retained wills may be older still, so they're opened only to be cleared, see clear.
+func (b *broker) open(m mqtt.Message) (interface{}, error) {
+	if strings.HasPrefix(m.Topic(), b.heartbeatTopics()) {
+		return envelope.OpenWill(m.Payload())
+	}
+	return envelope.Open(m.Payload())
+}
+
+// clear removes the retained message from a departed node's heartbeat topic, so obituaries don't accumulate on the
+// broker. Every listener that sees an obituary clears it, which is harmless as the topic is never used again.
+func (b *broker) clear(topic string) {
+	token := b.client.Publish(topic, b.QoS, true, []byte{})
+	go func() {
+		if token.WaitTimeout(30*time.Second) && token.Error() != nil {
+			log.WithError(token.Error()).WithField("topic", topic).Warn("unable to clear retained obituary")
+		}
+	}()
+}
+
+func (b *broker) parseMqttMessages(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) {
+	heartbeatTimer := time.NewTicker(heartbeat.RoutineInterval())
+	defer heartbeatTimer.Stop()
+	for {
+		select {
+		case <-heartbeatTimer.C:
+			// The client reconnects automatically, so while it's disconnected we stay quiet and let the watchdog
+			// decide if it's taken too long.
+			if !b.client.IsConnectionOpen() {
+				log.Warn("MQTT connection is down, waiting for reconnect")
+				continue
+			}
+			result <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+		case message := <-b.inbox:
+			// Clearing a retained message delivers an empty payload, which isn't a message
+			if len(message.Payload()) == 0 {
+				continue
+			}
+			v, err := b.open(message)
+			if err != nil {
+				if envelope.Duplicate(err) {
+					continue // already received over another path
+				}
+				// A node's retained heartbeat is usually older than the age limit by the time we subscribe
+				if message.Retained() && envelope.Stale(err) {
+					log.WithField("topic", message.Topic()).Debug("dropped a stale retained message")
+					continue
+				}
+				log.WithFields(logrus.Fields{
+					"error": err,
+					"topic": message.Topic(),
+				}).Warn("dropped a message")
+				continue
+			}
+			switch m := v.(type) {
+			case check.Status:
+				log.Info("received a Status")
+				log.WithFields(logrus.Fields{
+					"status": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Status")
+				schan <- m
+			case heartbeat.Beat:
+				if m.IsObituary() {
+					b.clear(message.Topic())
+					// A retained obituary is from a node that left before we subscribed, so we never knew it
+					if message.Retained() {
+						continue
+					}
+				}
+				log.Info("received a Heartbeat")
+				log.WithFields(logrus.Fields{
+					"beat": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Heartbeat")
+				hchan <- m
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package nats
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/listen"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+)
+
+var log *logrus.Entry
+
+// Config contains all data used to connect to a NATS server or cluster.
+type Config struct {
+	URL           string `json:"url"`            // one or more comma-separated server URLs
+	SubjectPrefix string `json:"subject-prefix"` // messages are received from <prefix>.status and <prefix>.heartbeat
+	Token         string `json:"token"`          // optional token authentication
+	NkeySeedFile  string `json:"nkey-seed-file"` // optional nkey authentication
+	MaxReconnects int    `json:"max-reconnects"` // reconnect attempts before giving up, negative for unlimited
+	ReconnectWait int    `json:"reconnect-wait"` // seconds between reconnect attempts
+}
+
+func (c *Config) validate() error {
+	if c.URL == "" {
+		return errors.New("missing url field")
+	}
+	if c.Token != "" && c.NkeySeedFile != "" {
+		return errors.New("token and nkey-seed-file are mutually exclusive")
+	}
+	if c.SubjectPrefix == "" {
+		c.SubjectPrefix = "dpoller"
+	}
+	if c.MaxReconnects == 0 {
+		c.MaxReconnects = -1
+	}
+	if c.ReconnectWait <= 0 {
+		c.ReconnectWait = 2
+	}
+	return nil
+}
+
+// initialise turns the provided config []byte into a validated server, generates the listen channels and subscribes
+// to the dpoller subjects.
+func initialise(config json.RawMessage, ll logrus.Level) (result chan error, hchan chan heartbeat.Beat, schan chan check.Status, err error) {
+
+	log = logger.New("natsListen", ll)
+
+	log.Debug("Initialising NATS listener")
+	var c Config
+	if err := json.Unmarshal(config, &c); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "unable to parse NATS config")
+	}
+	if err := c.validate(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "could not validate config")
+	}
+	s := &server{Config: c}
+	if err := s.connect(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error while connecting listener")
+	}
+
+	result = make(chan error, 10)
+	hchan = make(chan heartbeat.Beat)
+	schan = make(chan check.Status)
+
+	if err := s.listen(result, hchan, schan); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error while calling listen function")
+	}
+	log.Debug("Completed NATS listener configuration")
+	return result, hchan, schan, nil
+}
+
+func init() {
+	listen.RegisterConfigFunction("nats", initialise)
+}
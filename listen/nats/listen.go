@@ -0,0 +1,117 @@
+package nats
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// server is an active connection to a NATS server.
+type server struct {
+	Config
+	conn  *nats.Conn
+	inbox chan *nats.Msg
+}
+
+// connect establishes a connection to the NATS server. Subscriptions are restored by the client library when it
+// reconnects, so the listener only needs to watch the connection state.
+func (s *server) connect() error {
+	opts := []nats.Option{
+		nats.Name("dpoller listener"),
+		nats.MaxReconnects(s.MaxReconnects),
+		nats.ReconnectWait(time.Duration(s.ReconnectWait) * time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.WithError(err).Warn("disconnected from NATS server")
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.WithField("server", c.ConnectedUrl()).Info("reconnected to NATS server")
+		}),
+	}
+	if s.Token != "" {
+		opts = append(opts, nats.Token(s.Token))
+	}
+	if s.NkeySeedFile != "" {
+		o, err := nats.NkeyOptionFromSeed(s.NkeySeedFile)
+		if err != nil {
+			return errors.Wrap(err, "could not load nkey seed")
+		}
+		opts = append(opts, o)
+	}
+	var err error
+	if s.conn, err = nats.Connect(s.URL, opts...); err != nil {
+		return errors.Wrap(err, "could not connect to NATS server")
+	}
+	return nil
+}
+
+// listen subscribes to the status and heartbeat subjects and sets up a parsing routine.
+func (s *server) listen(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) error {
+	s.inbox = make(chan *nats.Msg, 64)
+	for _, t := range []string{"status", "heartbeat"} {
+		if _, err := s.conn.ChanSubscribe(s.subject(t), s.inbox); err != nil {
+			return errors.Wrapf(err, "unable to subscribe to %v messages", t)
+		}
+	}
+	go s.parseNatsMessages(result, hchan, schan)
+	return nil
+}
+
+func (s *server) subject(msgType string) string {
+	return s.SubjectPrefix + "." + msgType
+}
+
+func (s *server) parseNatsMessages(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) {
+	heartbeatTimer := time.NewTicker(heartbeat.RoutineInterval())
+	defer heartbeatTimer.Stop()
+	for {
+		select {
+		case <-heartbeatTimer.C:
+			// Only report normal while connected. While the client is reconnecting we stay quiet and let the
+			// watchdog decide if it's taken too long; once the client gives up we report an error straight away.
+			switch {
+			case s.conn.IsConnected():
+				result <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+			case s.conn.IsClosed():
+				err := errors.New("NATS connection closed")
+				if last := s.conn.LastError(); last != nil {
+					err = errors.Wrap(last, "NATS connection closed")
+				}
+				result <- err
+				return
+			default:
+				log.Warn("NATS connection is down, waiting for reconnect")
+			}
+		case message := <-s.inbox:
+			v, err := envelope.Open(message.Data)
+			if err != nil {
+				if envelope.Duplicate(err) {
+					continue // already received over another path
+				}
+				log.WithFields(logrus.Fields{
+					"error":   err,
+					"subject": message.Subject,
+				}).Warn("dropped a message")
+				continue
+			}
+			switch m := v.(type) {
+			case check.Status:
+				log.Info("received a Status")
+				log.WithFields(logrus.Fields{
+					"status": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Status")
+				schan <- m
+			case heartbeat.Beat:
+				log.Info("received a Heartbeat")
+				log.WithFields(logrus.Fields{
+					"beat": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Heartbeat")
+				hchan <- m
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/url"
+	"github.com/alowde/dpoller/url/check"
+	natsd "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"net"
+	"testing"
+	"time"
+)
+
+var node1 = node.Node{
+	ID:   1000000000000000000,
+	EIP:  net.IP{10, 0, 0, 1},
+	Name: "test_node_1",
+}
+
+// runServer starts an embedded NATS server on a random port, optionally requiring token authentication.
+func runServer(t *testing.T, token string) *natsd.Server {
+	s, err := natsd.NewServer(&natsd.Options{Host: "127.0.0.1", Port: -1, Authorization: token})
+	if err != nil {
+		t.Fatalf("could not create embedded NATS server: %v", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("embedded NATS server did not start")
+	}
+	return s
+}
+
+func TestListen(t *testing.T) {
+	ns := runServer(t, "s3cret")
+	defer ns.Shutdown()
+
+	conf := fmt.Sprintf(`{"url": %q, "token": "s3cret", "subject-prefix": "test"}`, ns.ClientURL())
+	_, hchan, schan, err := initialise(json.RawMessage(conf), logrus.FatalLevel)
+	if err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+
+	pub, err := nats.Connect(ns.ClientURL(), nats.Token("s3cret"))
+	if err != nil {
+		t.Fatalf("could not connect test publisher: %v", err)
+	}
+	defer pub.Close()
+
+	node.Self = node1
+	url.Checks = check.Checks{{Name: "example", URL: "http://example.com"}}
+	beat, _ := envelope.Seal(heartbeat.Beat{Node: node1, Timestamp: time.Now()})
+	status, _ := envelope.Seal(check.Status{Node: node1, Url: url.Checks[0], StatusCode: 200})
+	if err := pub.Publish("test.heartbeat", beat); err != nil {
+		t.Fatalf("could not publish heartbeat: %v", err)
+	}
+	if err := pub.Publish("test.status", status); err != nil {
+		t.Fatalf("could not publish status: %v", err)
+	}
+
+	select {
+	case b := <-hchan:
+		if b.ID != node1.ID {
+			t.Errorf("Error in listen(), expected heartbeat from %v, got %v", node1.ID, b.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Error in listen(), no heartbeat received")
+	}
+	select {
+	case s := <-schan:
+		if s.StatusCode != 200 {
+			t.Errorf("Error in listen(), expected status code 200, got %v", s.StatusCode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Error in listen(), no status received")
+	}
+}
+
+func TestBadToken(t *testing.T) {
+	ns := runServer(t, "s3cret")
+	defer ns.Shutdown()
+
+	conf := fmt.Sprintf(`{"url": %q, "token": "wrong"}`, ns.ClientURL())
+	if _, _, _, err := initialise(json.RawMessage(conf), logrus.FatalLevel); err == nil {
+		t.Error("Error in initialise(), expected authentication failure")
+	}
+}
@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/listen"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/pkg/tlsconf"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+)
+
+var log *logrus.Entry
+
+// Config contains all data used to connect to a Redis server.
+type Config struct {
+	URL           string         `json:"url"`            // e.g. redis://:password@host:6379/0
+	Mode          string         `json:"mode"`           // "pubsub" (default) or "streams"
+	KeyPrefix     string         `json:"key-prefix"`     // messages are received from <prefix>:status and <prefix>:heartbeat
+	ReplayMinutes int            `json:"replay-minutes"` // in streams mode, minutes of statuses to replay on start
+	TLS           tlsconf.Config `json:"tls"`
+}
+
+func (c *Config) validate() error {
+	if c.URL == "" {
+		return errors.New("missing url field")
+	}
+	switch c.Mode {
+	case "":
+		c.Mode = "pubsub"
+	case "pubsub", "streams":
+	default:
+		return errors.Errorf("unknown mode %q, expected pubsub or streams", c.Mode)
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = "dpoller"
+	}
+	if c.ReplayMinutes < 0 {
+		return errors.New("replay-minutes can't be negative")
+	}
+	return nil
+}
+
+// initialise turns the provided config []byte into a validated server, generates the listen channels and starts
+// receiving from the dpoller channels or streams.
+func initialise(config json.RawMessage, ll logrus.Level) (result chan error, hchan chan heartbeat.Beat, schan chan check.Status, err error) {
+
+	log = logger.New("redisListen", ll)
+
+	log.Debug("Initialising Redis listener")
+	var c Config
+	if err := json.Unmarshal(config, &c); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "unable to parse Redis config")
+	}
+	if err := c.validate(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "could not validate config")
+	}
+	s := &server{Config: c}
+	if err := s.connect(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error while connecting listener")
+	}
+
+	result = make(chan error, 10)
+	hchan = make(chan heartbeat.Beat)
+	schan = make(chan check.Status)
+
+	if err := s.listen(result, hchan, schan); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error while calling listen function")
+	}
+	log.Debug("Completed Redis listener configuration")
+	return result, hchan, schan, nil
+}
+
+func init() {
+	listen.RegisterConfigFunction("redis", initialise)
+}
@@ -0,0 +1,220 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// message is a payload received from either a channel or a stream, tagged with its type.
+type message struct {
+	msgType  string
+	data     []byte
+	replayed bool // added to the stream before we started, see readStreams
+}
+
+// server is an active connection to a Redis server.
+type server struct {
+	Config
+	client *redis.Client
+	inbox  chan message
+}
+
+// connect creates the Redis client and checks the server is reachable.
+func (s *server) connect() error {
+	opts, err := redis.ParseURL(s.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid url")
+	}
+	if s.TLS.Enabled() {
+		if opts.TLSConfig, err = s.TLS.Build(); err != nil {
+			return errors.Wrap(err, "invalid TLS configuration")
+		}
+	}
+	s.client = redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return errors.Wrap(err, "could not reach Redis server")
+	}
+	return nil
+}
+
+// listen starts a receiver for the configured mode and sets up a parsing routine.
+func (s *server) listen(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) error {
+	s.inbox = make(chan message, 64)
+	if s.Mode == "streams" {
+		go s.readStreams()
+	} else {
+		ps := s.client.Subscribe(context.Background(), s.key("status"), s.key("heartbeat"))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := ps.Receive(ctx); err != nil {
+			return errors.Wrap(err, "unable to subscribe to Redis channels")
+		}
+		go s.readChannels(ps)
+	}
+	go s.parseRedisMessages(result, hchan, schan)
+	return nil
+}
+
+func (s *server) key(msgType string) string {
+	return s.KeyPrefix + ":" + msgType
+}
+
+// readChannels forwards pub/sub messages to the inbox. The PubSub reconnects and resubscribes by itself.
+func (s *server) readChannels(ps *redis.PubSub) {
+	for m := range ps.Channel() {
+		s.inbox <- message{
+			msgType: strings.TrimPrefix(m.Channel, s.KeyPrefix+":"),
+			data:    []byte(m.Payload),
+		}
+	}
+}
+
+// readStreams forwards stream entries to the inbox. Statuses are read from ReplayMinutes in the past so a newly started
+// node has recent results to work with; heartbeats are read from now as old ones would only be aged out again. Entries
+// added before we started are marked as replayed.
+func (s *server) readStreams() {
+	var start map[string]string
+	var now time.Time
+	for {
+		var err error
+		if start, now, err = s.origin(); err == nil {
+			break
+		}
+		log.WithError(err).Warn("failed to find where the Redis streams start, retrying")
+		time.Sleep(time.Second)
+	}
+	last := map[string]string{
+		"status":    streamID(now.Add(-s.replay())),
+		"heartbeat": start["heartbeat"],
+	}
+	for {
+		streams, err := s.client.XRead(context.Background(), &redis.XReadArgs{
+			Streams: []string{s.key("status"), s.key("heartbeat"), last["status"], last["heartbeat"]},
+			Count:   100,
+			Block:   5 * time.Second,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).Warn("failed to read from Redis streams, retrying")
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, stream := range streams {
+			msgType := strings.TrimPrefix(stream.Stream, s.KeyPrefix+":")
+			for _, m := range stream.Messages {
+				last[msgType] = m.ID
+				data, ok := m.Values["data"].(string)
+				if !ok {
+					log.WithField("id", m.ID).Warn("stream entry has no data field, skipping")
+					continue
+				}
+				s.inbox <- message{msgType: msgType, data: []byte(data), replayed: !olderID(start[msgType], m.ID)}
+			}
+		}
+	}
+}
+
+// origin returns the ID of the last entry in each stream and the server's time. Both come from the server, as stream
+// IDs are assigned by its clock rather than ours. A stream that doesn't exist yet has nothing to replay.
+func (s *server) origin() (start map[string]string, now time.Time, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if now, err = s.client.Time(ctx).Result(); err != nil {
+		return nil, now, errors.Wrap(err, "could not read the Redis server's time")
+	}
+	start = make(map[string]string)
+	for _, msgType := range []string{"status", "heartbeat"} {
+		info, err := s.client.XInfoStream(ctx, s.key(msgType)).Result()
+		switch {
+		case err == nil:
+			start[msgType] = info.LastGeneratedID
+		case strings.Contains(err.Error(), "no such key"):
+			start[msgType] = "0-0"
+		default:
+			return nil, now, errors.Wrapf(err, "could not read the %v stream", msgType)
+		}
+	}
+	return start, now, nil
+}
+
+// replay returns how far back statuses are replayed.
+func (s *server) replay() time.Duration {
+	return time.Duration(s.ReplayMinutes) * time.Minute
+}
+
+// streamID returns the first Redis stream ID at or after the given time.
+func streamID(t time.Time) string {
+	return fmt.Sprintf("%d-0", t.UnixNano()/int64(time.Millisecond))
+}
+
+// olderID reports whether a stream ID was assigned before another. IDs are a millisecond timestamp and a sequence
+// number, both of which must be compared numerically.
+func olderID(id, than string) bool {
+	var ms, seq, thanMs, thanSeq int64
+	fmt.Sscanf(id, "%d-%d", &ms, &seq)
+	fmt.Sscanf(than, "%d-%d", &thanMs, &thanSeq)
+	return ms < thanMs || (ms == thanMs && seq < thanSeq)
+}
+
+func (s *server) parseRedisMessages(result chan error, hchan chan heartbeat.Beat, schan chan check.Status) {
+	heartbeatTimer := time.NewTicker(heartbeat.RoutineInterval())
+	defer heartbeatTimer.Stop()
+	for {
+		select {
+		case <-heartbeatTimer.C:
+			// Only report normal while the server is reachable, otherwise let the watchdog decide if the outage has
+			// gone on too long.
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := s.client.Ping(ctx).Err()
+			cancel()
+			if err != nil {
+				log.WithError(err).Warn("Redis server is unreachable")
+				continue
+			}
+			result <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+		case m := <-s.inbox:
+			// Replayed statuses are older than the usual age limit by design
+			open := envelope.Open
+			if m.replayed {
+				open = func(data []byte) (interface{}, error) { return envelope.OpenReplayed(data, s.replay()) }
+			}
+			v, err := open(m.data)
+			if err != nil {
+				if envelope.Duplicate(err) {
+					continue // already received over another path
+				}
+				log.WithFields(logrus.Fields{
+					"error": err,
+					"type":  m.msgType,
+				}).Warn("dropped a message")
+				continue
+			}
+			switch m := v.(type) {
+			case check.Status:
+				log.Info("received a Status")
+				log.WithFields(logrus.Fields{
+					"status": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Status")
+				schan <- m
+			case heartbeat.Beat:
+				log.Info("received a Heartbeat")
+				log.WithFields(logrus.Fields{
+					"beat": fmt.Sprintf("%#v", m),
+				}).Debug("decoded a Heartbeat")
+				hchan <- m
+			}
+		}
+	}
+}
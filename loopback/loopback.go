@@ -0,0 +1,212 @@
+// Package loopback implements an in-process transport. Messages published to a Bus are delivered to every subscriber
+// of that Bus without leaving the process, which allows a single node to run without any broker and allows tests to
+// simulate several nodes sharing one bus.
+// The package registers as both a listener and a publisher. Both take an optional "bus" name so that unrelated
+// configurations don't share messages; the default is "default".
+package loopback
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/listen"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/publish"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+var log *logrus.Entry
+
+// Bus distributes messages to its subscribers.
+type Bus struct {
+	sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+// Subscriber receives every message published to the Bus it subscribed to, other than those sent by its own node.
+type Subscriber struct {
+	Beats    chan heartbeat.Beat
+	Statuses chan check.Status
+	self     int64 // ID of the node the Subscriber belongs to, if any
+}
+
+var buses = make(map[string]*Bus)
+var busesLock sync.Mutex
+
+// Get returns the named Bus, creating it if required.
+func Get(name string) *Bus {
+	busesLock.Lock()
+	defer busesLock.Unlock()
+	if b, ok := buses[name]; ok {
+		return b
+	}
+	b := NewBus()
+	buses[name] = b
+	return b
+}
+
+// NewBus returns an unnamed Bus, useful where a test needs a bus nothing else can see.
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*Subscriber]struct{})}
+}
+
+// Subscribe returns a new Subscriber that will receive all messages published from now on.
+func (b *Bus) Subscribe() *Subscriber {
+	return b.SubscribeAs(0)
+}
+
+// SubscribeAs returns a new Subscriber for the given node, which will receive all messages published from now on
+// except those the node publishes itself. A node's own messages are delivered to it by publish.Publish, so receiving
+// them from the bus too would deliver them twice whenever another transport also carries them back.
+func (b *Bus) SubscribeAs(id int64) *Subscriber {
+	s := &Subscriber{
+		Beats:    make(chan heartbeat.Beat, 64),
+		Statuses: make(chan check.Status, 64),
+		self:     id,
+	}
+	b.Lock()
+	b.subscribers[s] = struct{}{}
+	b.Unlock()
+	return s
+}
+
+// Unsubscribe stops delivery to the given Subscriber.
+func (b *Bus) Unsubscribe(s *Subscriber) {
+	b.Lock()
+	delete(b.subscribers, s)
+	b.Unlock()
+}
+
+// Publish delivers a check.Status or heartbeat.Beat to every subscriber other than the sender's own. Subscribers with
+// room are delivered to first, then Publish waits for any that aren't keeping up until the context expires. The bus
+// isn't locked while waiting, so subscribers can still come and go.
+func (b *Bus) Publish(ctx context.Context, i interface{}) error {
+	var sender int64
+	switch v := i.(type) {
+	case check.Status:
+		sender = v.Node.ID
+	case heartbeat.Beat:
+		sender = v.ID
+	default:
+		return errors.New("unknown type of message")
+	}
+	var subscribers []*Subscriber
+	b.RLock()
+	for s := range b.subscribers {
+		if s.self == 0 || s.self != sender {
+			subscribers = append(subscribers, s)
+		}
+	}
+	b.RUnlock()
+
+	var waiting []*Subscriber
+	for _, s := range subscribers {
+		if !s.deliver(nil, i) {
+			waiting = append(waiting, s)
+		}
+	}
+	for _, s := range waiting {
+		if !s.deliver(ctx.Done(), i) {
+			return errors.New("deadline expired while publishing to loopback bus")
+		}
+	}
+	return nil
+}
+
+// deliver sends a message to the subscriber, waiting until done is closed if it has no room. It doesn't wait at all if
+// done is nil.
+func (s *Subscriber) deliver(done <-chan struct{}, i interface{}) bool {
+	switch v := i.(type) {
+	case check.Status:
+		if done == nil {
+			select {
+			case s.Statuses <- v:
+				return true
+			default:
+				return false
+			}
+		}
+		select {
+		case s.Statuses <- v:
+			return true
+		case <-done:
+		}
+	case heartbeat.Beat:
+		if done == nil {
+			select {
+			case s.Beats <- v:
+				return true
+			default:
+				return false
+			}
+		}
+		select {
+		case s.Beats <- v:
+			return true
+		case <-done:
+		}
+	}
+	return false
+}
+
+// Config selects the bus a node is attached to.
+type Config struct {
+	Bus string `json:"bus"`
+}
+
+func parseConfig(config json.RawMessage) (c Config, err error) {
+	if err = json.Unmarshal(config, &c); err != nil {
+		return c, errors.Wrap(err, "could not parse configuration")
+	}
+	if c.Bus == "" {
+		c.Bus = "default"
+	}
+	return c, nil
+}
+
+func initialisePublisher(config json.RawMessage, ll logrus.Level) (publish.Publisher, error) {
+	log = logger.New("loopbackPublish", ll)
+	c, err := parseConfig(config)
+	if err != nil {
+		return publish.Publisher{}, err
+	}
+	bus := Get(c.Bus)
+	log.WithField("bus", c.Bus).Debug("Completed loopback publisher configuration")
+	return publish.Publisher{
+		Status: func(ctx context.Context, status check.Status, _ []byte) error {
+			return bus.Publish(ctx, status)
+		},
+		Heartbeat: func(ctx context.Context, beat heartbeat.Beat, _ []byte) error {
+			return bus.Publish(ctx, beat)
+		},
+	}, nil
+}
+
+func initialiseListener(config json.RawMessage, ll logrus.Level) (result chan error, hchan chan heartbeat.Beat, schan chan check.Status, err error) {
+	log = logger.New("loopbackListen", ll)
+	c, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	s := Get(c.Bus).SubscribeAs(node.Self.ID)
+
+	// Nothing can go wrong with an in-process bus, so the listener is always healthy
+	result = make(chan error, 10)
+	go func() {
+		for range time.Tick(heartbeat.RoutineInterval()) {
+			result <- heartbeat.RoutineNormal{Timestamp: time.Now()}
+		}
+	}()
+	log.WithField("bus", c.Bus).Debug("Completed loopback listener configuration")
+	return result, s.Beats, s.Statuses, nil
+}
+
+func init() {
+	listen.RegisterConfigFunction("loopback", initialiseListener)
+	publish.RegisterPublisherFunction("loopback", initialisePublisher)
+}
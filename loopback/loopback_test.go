@@ -0,0 +1,108 @@
+package loopback
+
+import (
+	"context"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"net"
+	"testing"
+	"time"
+)
+
+var nodes = []node.Node{
+	{ID: 3000000000000000000, EIP: net.IP{10, 0, 0, 3}, Name: "test_node_3"},
+	{ID: 1000000000000000000, EIP: net.IP{10, 0, 0, 1}, Name: "test_node_1"},
+	{ID: 2000000000000000000, EIP: net.IP{10, 0, 0, 2}, Name: "test_node_2"},
+}
+
+// TestSimulatedCluster runs an election round for several simulated nodes sharing one bus. Every node should see
+// every other node's heartbeat, and only the lowest ID should take the feasible coordinator role.
+func TestSimulatedCluster(t *testing.T) {
+	heartbeat.Initialise(logrus.FatalLevel)
+
+	bus := NewBus()
+	subs := make([]*Subscriber, len(nodes))
+	for i, n := range nodes {
+		subs[i] = bus.SubscribeAs(n.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, n := range nodes {
+		if err := bus.Publish(ctx, heartbeat.Beat{Node: n, Timestamp: time.Now()}); err != nil {
+			t.Fatalf("Received error %v", err)
+		}
+	}
+
+	for i, n := range nodes {
+		// A node knows its own heartbeat without receiving it
+		known := heartbeat.NewBeatMap()
+		known[n.ID] = heartbeat.Beat{Node: n, Timestamp: time.Now()}
+		for range nodes[1:] {
+			b := <-subs[i].Beats
+			if b.ID == n.ID {
+				t.Fatalf("Error in Publish(), node %v received its own heartbeat", n.Name)
+			}
+			known[b.ID] = b
+		}
+		select {
+		case b := <-subs[i].Beats:
+			t.Fatalf("Error in Publish(), node %v received an unexpected heartbeat from %v", n.Name, b.ID)
+		default:
+		}
+		if len(known) != len(nodes) {
+			t.Fatalf("Error in Publish(), node %v saw %v nodes, expected %v", n.Name, len(known), len(nodes))
+		}
+		d, err := known.ToBeats().Evaluate(false, false, n.ID)
+		if err != nil {
+			t.Fatalf("Error in Evaluate() for %v: %v", n.Name, err)
+		}
+		if isFeas, shouldBeFeas := d.IsFeasible(), n.ID == 1000000000000000000; isFeas != shouldBeFeas {
+			t.Errorf("Error in Evaluate() for %v, Feasible was %t, should be %t", n.Name, isFeas, shouldBeFeas)
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	s := bus.Subscribe()
+	bus.Unsubscribe(s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bus.Publish(ctx, heartbeat.Beat{Node: nodes[0]}); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	select {
+	case <-s.Beats:
+		t.Error("Error in Unsubscribe(), message delivered after unsubscribing")
+	default:
+	}
+}
+
+// TestSlowSubscriber checks that a subscriber that isn't reading neither holds up delivery to the others nor stops
+// subscribers coming and going while a publish waits for it.
+func TestSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	slow, fast := bus.Subscribe(), bus.Subscribe()
+	for len(slow.Beats) < cap(slow.Beats) {
+		slow.Beats <- heartbeat.Beat{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	published := make(chan error)
+	go func() { published <- bus.Publish(ctx, heartbeat.Beat{Node: nodes[0]}) }()
+
+	select {
+	case <-fast.Beats:
+	case <-time.After(500 * time.Millisecond):
+		t.Errorf("Error in Publish(), a full subscriber held up delivery to another")
+	}
+	bus.Unsubscribe(fast)
+	bus.SubscribeAs(nodes[1].ID)
+	if err := <-published; err == nil {
+		t.Errorf("Error in Publish(), expected the deadline to expire waiting for the full subscriber")
+	}
+}
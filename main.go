@@ -3,16 +3,28 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"github.com/Sirupsen/logrus"
 	_ "github.com/alowde/dpoller/alert/smtp"
 	"github.com/alowde/dpoller/config"
+	_ "github.com/alowde/dpoller/gossip"
 	"github.com/alowde/dpoller/heartbeat"
 	_ "github.com/alowde/dpoller/listen/amqp"
+	_ "github.com/alowde/dpoller/listen/kafka"
+	_ "github.com/alowde/dpoller/listen/mqtt"
+	_ "github.com/alowde/dpoller/listen/nats"
+	_ "github.com/alowde/dpoller/listen/redis"
 	"github.com/alowde/dpoller/logger"
+	_ "github.com/alowde/dpoller/loopback"
 	"github.com/alowde/dpoller/node"
 	"github.com/alowde/dpoller/pkg/flags"
 	"github.com/alowde/dpoller/publish"
 	_ "github.com/alowde/dpoller/publish/amqp"
+	_ "github.com/alowde/dpoller/publish/kafka"
+	_ "github.com/alowde/dpoller/publish/mqtt"
+	_ "github.com/alowde/dpoller/publish/nats"
+	_ "github.com/alowde/dpoller/publish/redis"
+	"os"
 	"time"
 )
 
@@ -29,6 +41,20 @@ func main() {
 
 	log = logger.New("main", flags.MainLog.Level)
 
+	// Commands query a running node rather than starting one
+	if flag.NArg() > 0 {
+		command, ok := commands[flag.Arg(0)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+			os.Exit(2)
+		}
+		if err := command(os.Stdout, flags.API); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialise the instance of the application with runtime data - random ID, external IP address etc.
 	if err := node.Initialise(flags.ConfLog.Level); err != nil {
 		log.Debugf("%+v\n", err)
@@ -63,7 +89,7 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		if err := publish.Publish(ctx, heartbeat.NewBeat()); err != nil {
 			cancel()
-			log.Fatal("died due to can't publish")
+			log.WithError(err).Fatal("died due to can't publish")
 		}
 		cancel()
 	}
@@ -73,12 +99,6 @@ func main() {
 // whether this node is a coordinator/feasible coordinator or not.
 // This might be more idiomatic implemented as a dynamic time.Ticker but this works and is obvious about how it works.
 func waitBetweenChecks() {
-	var waitTime time.Duration
-	if heartbeat.GetCoordinator() || heartbeat.GetFeasibleCoordinator() {
-		waitTime = 5 * time.Second
-	} else {
-		waitTime = 30 * time.Second
-	}
-	wait := time.After(waitTime)
+	wait := time.After(heartbeat.BeatInterval())
 	<-wait
 }
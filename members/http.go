@@ -0,0 +1,14 @@
+package members
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the membership view as a JSON array.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(List()); err != nil {
+		log.WithError(err).Warn("could not write membership view")
+	}
+}
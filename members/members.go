@@ -0,0 +1,121 @@
+// Package members maintains the cluster membership view: every node this node has heard from, where it runs and the
+// roles it has held. The view is derived from the heartbeats the coordinate routine collects.
+package members
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/node"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyLength is the number of role changes kept for each member.
+const historyLength = 20
+
+// Change records a member taking on a role.
+type Change struct {
+	Role  string    `json:"role"`
+	At    time.Time `json:"at"`
+	Epoch uint64    `json:"epoch,omitempty"` // lease epoch, for the Coordinator role
+}
+
+// Member is a node in the cluster as seen by this node.
+type Member struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	EIP       net.IP            `json:"eip"`
+	Version   string            `json:"version"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	NodeRole  node.Role         `json:"node-role"`
+	Role      string            `json:"role"`
+	FirstSeen time.Time         `json:"first-seen"`
+	LastSeen  time.Time         `json:"last-seen"`
+	History   []Change          `json:"history"` // most recent last
+}
+
+var table = struct {
+	sync.Mutex
+	members map[int64]*Member
+}{members: make(map[int64]*Member)}
+
+var log *logrus.Entry
+
+// Initialise configures logging for the membership view.
+func Initialise(ll logrus.Level) {
+	log = logger.New("members", ll)
+}
+
+// Observe updates the membership view from the currently known Beats. Nodes that have appeared since the last
+// observation have joined and nodes that are missing have left, whether they announced it or aged out.
+func Observe(bm heartbeat.BeatMap) {
+	table.Lock()
+	defer table.Unlock()
+	for id, b := range bm {
+		m, ok := table.members[id]
+		if !ok {
+			m = &Member{ID: id, FirstSeen: b.Timestamp}
+			table.members[id] = m
+			log.WithFields(logrus.Fields{
+				"node":    id,
+				"name":    b.Name,
+				"eip":     b.EIP,
+				"version": b.Version,
+			}).Info("node joined")
+		}
+		m.Name, m.EIP, m.Version, m.Labels, m.LastSeen = b.Name, b.EIP, b.Version, b.Labels, b.Timestamp
+		if m.NodeRole = b.NodeRole; m.NodeRole == "" {
+			m.NodeRole = node.Prober
+		}
+		if role := b.Role().String(); role != m.Role {
+			c := Change{Role: role, At: b.Timestamp}
+			if b.Coordinator {
+				c.Epoch = b.Epoch
+			}
+			if m.History = append(m.History, c); len(m.History) > historyLength {
+				m.History = m.History[len(m.History)-historyLength:]
+			}
+			m.Role = role
+		}
+	}
+	for id, m := range table.members {
+		if _, ok := bm[id]; !ok {
+			delete(table.members, id)
+			log.WithFields(logrus.Fields{
+				"node":      id,
+				"name":      m.Name,
+				"last-seen": m.LastSeen,
+			}).Info("node left")
+		}
+	}
+}
+
+// List returns a copy of every current member, ordered by ID.
+func List() []Member {
+	table.Lock()
+	defer table.Unlock()
+	ms := make([]Member, 0, len(table.members))
+	for _, m := range table.members {
+		c := *m
+		c.History = append([]Change(nil), m.History...)
+		ms = append(ms, c)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].ID < ms[j].ID })
+	return ms
+}
+
+// Get returns a copy of a single member.
+func Get(id int64) (Member, bool) {
+	table.Lock()
+	defer table.Unlock()
+	m, ok := table.members[id]
+	if !ok {
+		return Member{}, false
+	}
+	c := *m
+	c.History = append([]Change(nil), m.History...)
+	return c, true
+}
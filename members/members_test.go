@@ -0,0 +1,39 @@
+package members
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+
+	Initialise(logrus.FatalLevel)
+
+	start := time.Now()
+	one := heartbeat.Beat{Node: node.Node{ID: 1, Name: "one", Labels: map[string]string{"region": "eu"}},
+		Timestamp: start, Version: "v1"}
+	two := heartbeat.Beat{Node: node.Node{ID: 2, Name: "two"}, Timestamp: start}
+
+	Observe(heartbeat.BeatMap{1: one, 2: two})
+	if ms := List(); len(ms) != 2 || ms[0].ID != 1 || ms[0].Labels["region"] != "eu" || ms[0].Role != "none" {
+		t.Fatalf("Error in Observe(), expected both nodes to join, got %+v", ms)
+	}
+
+	// node one is promoted and node two leaves
+	later := start.Add(time.Minute)
+	one.Coordinator, one.Epoch, one.Timestamp = true, 7, later
+	Observe(heartbeat.BeatMap{1: one})
+	m, ok := Get(1)
+	if !ok || m.Role != "coordinator" || !m.FirstSeen.Equal(start) || !m.LastSeen.Equal(later) {
+		t.Errorf("Error in Observe(), expected node one to be the Coordinator since %v, got %+v", start, m)
+	}
+	if len(m.History) != 2 || m.History[1].Epoch != 7 {
+		t.Errorf("Error in Observe(), expected the promotion in the role history, got %+v", m.History)
+	}
+	if _, ok := Get(2); ok {
+		t.Errorf("Error in Observe(), expected node two to have left")
+	}
+}
@@ -0,0 +1,46 @@
+package node
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// Version is the running build of dpoller, set at build time with
+// -ldflags "-X github.com/alowde/dpoller/node.Version=..."
+var Version = "dev"
+
+// Config describes this node to the rest of the cluster.
+type Config struct {
+	Name   string            `json:"name"`   // defaults to the hostname
+	Labels map[string]string `json:"labels"` // e.g. {"region": "eu-west", "provider": "aws"}
+	Role   Role              `json:"role"`   // defaults to prober
+}
+
+// Configure applies the node configuration, which may be nil if none was provided.
+func Configure(config *json.RawMessage) error {
+	var c Config
+	if config != nil {
+		if err := json.Unmarshal(*config, &c); err != nil {
+			return errors.Wrap(err, "could not parse node configuration")
+		}
+	}
+	for k := range c.Labels {
+		if k == "" {
+			return errors.New("label names must not be empty")
+		}
+	}
+	if c.Role == "" {
+		c.Role = Prober
+	}
+	if err := c.Role.validate(); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		c.Name, _ = os.Hostname()
+	}
+	Self.Name = c.Name
+	Self.Labels = c.Labels
+	SelfRole = c.Role
+	return nil
+}
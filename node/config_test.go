@@ -0,0 +1,40 @@
+package node
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfigure(t *testing.T) {
+	defer func() { Self, SelfRole = Node{}, Prober }()
+
+	tables := []struct {
+		description string
+		config      string
+		role        Role
+		valid       bool
+	}{
+		{"defaults", `{}`, Prober, true},
+		{"observer", `{"name": "dc1", "role": "observer"}`, Observer, true},
+		{"coordinator-only", `{"role": "coordinator-only", "labels": {"region": "eu"}}`, CoordinatorOnly, true},
+		{"unknown role", `{"role": "watcher"}`, "", false},
+		{"empty label", `{"labels": {"": "x"}}`, "", false},
+	}
+	for _, table := range tables {
+		raw := json.RawMessage(table.config)
+		err := Configure(&raw)
+		if (err == nil) != table.valid {
+			t.Errorf("Error in Configure() for case %q, expected valid %v, got %v", table.description, table.valid, err)
+		}
+		if err == nil && SelfRole != table.role {
+			t.Errorf("Error in Configure() for case %q, expected role %v, got %v", table.description, table.role, SelfRole)
+		}
+	}
+
+	if !Prober.Probes() || !Role("").Probes() || CoordinatorOnly.Probes() || Observer.Probes() {
+		t.Errorf("Error in Probes(), only probers and nodes without a role should probe")
+	}
+	if !CoordinatorOnly.MayCoordinate() || Observer.MayCoordinate() {
+		t.Errorf("Error in MayCoordinate(), only observers should be excluded")
+	}
+}
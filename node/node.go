@@ -14,9 +14,10 @@ import (
 
 // Node is an instance of the dpoller application.
 type Node struct {
-	ID   int64
-	EIP  net.IP
-	Name string
+	ID     int64
+	EIP    net.IP
+	Name   string
+	Labels map[string]string // free-form description of where the node runs, e.g. region, provider or network
 }
 
 // Self is the current running node.
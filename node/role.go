@@ -0,0 +1,34 @@
+package node
+
+import "github.com/pkg/errors"
+
+// Role describes what part a node plays in the cluster.
+type Role string
+
+// Node roles. Every role receives statuses and heartbeats and can serve the API.
+const (
+	Prober          Role = "prober"           // runs checks and may hold the Coordinator role
+	CoordinatorOnly Role = "coordinator-only" // may hold the Coordinator role but doesn't run checks
+	Observer        Role = "observer"         // neither runs checks nor holds the Coordinator role
+)
+
+// SelfRole is the current running node's role.
+var SelfRole = Prober
+
+// Probes reports whether a node in this role runs checks. Nodes that don't advertise a role predate roles and probe.
+func (r Role) Probes() bool {
+	return r == Prober || r == ""
+}
+
+// MayCoordinate reports whether a node in this role may hold the Coordinator or Feasible Coordinator role.
+func (r Role) MayCoordinate() bool {
+	return r != Observer
+}
+
+func (r Role) validate() error {
+	switch r {
+	case Prober, CoordinatorOnly, Observer:
+		return nil
+	}
+	return errors.Errorf("unknown role %q, expected prober, coordinator-only or observer", r)
+}
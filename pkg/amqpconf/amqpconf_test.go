@@ -0,0 +1,42 @@
+package amqpconf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tables := []struct {
+		description string
+		config      Config
+		port        int
+		valid       bool
+	}{
+		{"defaults", Config{Host: "mq", User: "u", Pass: "p"}, 5672, true},
+		{"amqps default port", Config{Host: "mq", User: "u", Pass: "p", Scheme: "amqps"}, 5671, true},
+		{"missing password", Config{Host: "mq", User: "u"}, 0, false},
+		{"unknown scheme", Config{Host: "mq", User: "u", Pass: "p", Scheme: "http"}, 0, false},
+		{"uri only", Config{URI: "amqps://u:p@mq/vhost"}, 0, true},
+	}
+	for _, table := range tables {
+		err := table.config.Validate()
+		if (err == nil) != table.valid {
+			t.Errorf("Error in Validate() for case %q, expected valid %v, got %v", table.description, table.valid, err)
+		}
+		if err == nil && table.config.Port != table.port {
+			t.Errorf("Error in Validate() for case %q, expected port %v, got %v", table.description, table.port,
+				table.config.Port)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	for _, c := range []Config{
+		{Host: "mq", User: "u", Pass: "s3cret", Scheme: "amqp", Port: 5672},
+		{URI: "amqps://u:s3cret@mq:5671/vhost"},
+	} {
+		if r := c.Redacted(); strings.Contains(r, "s3cret") || !strings.Contains(r, "mq") {
+			t.Errorf("Error in Redacted(), got %v", r)
+		}
+	}
+}
@@ -7,7 +7,10 @@ import (
 )
 
 var MainLog LogLevel
-var AlertLog, ConfLog, ConsensusLog, CoordLog, BeatLog, ListenLog, PubLog, UrlLog LogLevel
+var AlertLog, APILog, ConfLog, ConsensusLog, CoordLog, BeatLog, ListenLog, PubLog, SecurityLog, UrlLog LogLevel
+
+// API is the address of a running node's API, used by commands that query it
+var API string
 
 // LogLevel is an abstraction of logrus.Level that can be configured with the flags package
 type LogLevel struct {
@@ -46,13 +49,16 @@ func (ll *LogLevel) Default(value string) error {
 func Create() {
 	flag.Var(&MainLog, "mainLogLevel", "log level for main routine (debug/info/warn/fatal)")
 	flag.Var(&AlertLog, "alertLogLevel", "log level for alert routine (debug/info/warn/fatal)")
+	flag.Var(&APILog, "apiLogLevel", "log level for the API server (debug/info/warn/fatal)")
 	flag.Var(&ConfLog, "confLogLevel", "log level for config routine (debug/info/warn/fatal)")
 	flag.Var(&ConsensusLog, "consensusLogLevel", "log level for consensus routine (debug/info/warn/fatal)")
 	flag.Var(&CoordLog, "coordinatorLogLevel", "log level for coordinator routine (debug/info/warn/fatal)")
 	flag.Var(&BeatLog, "heartbeatLogLevel", "log level for heartbeat routine (debug/info/warn/fatal)")
 	flag.Var(&ListenLog, "listenLogLevel", "log level for listen routine (debug/info/warn/fatal)")
 	flag.Var(&PubLog, "publishLogLevel", "log level for publish routine (debug/info/warn/fatal)")
+	flag.Var(&SecurityLog, "securityLogLevel", "log level for message authentication (debug/info/warn/fatal)")
 	flag.Var(&UrlLog, "urlLogLevel", "log level for url routine (debug/info/warn/fatal)")
+	flag.StringVar(&API, "api", "http://127.0.0.1:8080", "address of the node API queried by commands such as members")
 }
 
 // Fill initialises the defined flags, defaulting to the level of the Main routine
@@ -60,7 +66,7 @@ func Fill() {
 	if !MainLog.set {
 		MainLog.Set("warn")
 	}
-	for _, v := range [8]*LogLevel{&AlertLog, &ConfLog, &ConsensusLog, &CoordLog, &BeatLog, &ListenLog, &PubLog, &UrlLog} {
+	for _, v := range [10]*LogLevel{&AlertLog, &APILog, &ConfLog, &ConsensusLog, &CoordLog, &BeatLog, &ListenLog, &PubLog, &SecurityLog, &UrlLog} {
 		v.Default(MainLog.Level.String())
 	}
 }
@@ -0,0 +1,53 @@
+// Package tlsconf builds TLS client configuration from the options shared by the transport modules.
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"io/ioutil"
+)
+
+// Config describes how a transport should secure its connection. It's intended to be embedded in a module's own
+// configuration under a "tls" key.
+type Config struct {
+	CAFile             string `json:"ca-file"`              // PEM bundle used instead of the system roots
+	CertFile           string `json:"cert-file"`            // PEM client certificate, requires key-file
+	KeyFile            string `json:"key-file"`             // PEM client key, requires cert-file
+	ServerName         string `json:"server-name"`          // overrides the name used to verify the server
+	InsecureSkipVerify bool   `json:"insecure-skip-verify"` // disables server verification, for testing only
+}
+
+// Enabled reports whether any TLS option has been set.
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+// Build returns a *tls.Config reflecting the configured options.
+func (c Config) Build() (*tls.Config, error) {
+	t := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read CA file")
+		}
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA file")
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("cert-file and key-file must be provided together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load client certificate")
+		}
+		t.Certificates = []tls.Certificate{cert}
+	}
+	return t, nil
+}
@@ -2,45 +2,41 @@ package amqp
 
 import (
 	"context"
-	"fmt"
-	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/pkg/amqpconf"
 	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
+	"sync"
 	"time"
 )
 
 // broker contains all of the information required to connect to an AMQP broker.
 type broker struct {
-	connection *amqp.Connection // broker connection object
-	achannel   *amqp.Channel    // default AMQP channel
-	closed     chan *amqp.Error // connection closed flag
-	Host       string           `json:"host"`
-	User       string           `json:"user"`
-	Pass       string           `json:"pass"`
-	Scheme     string           `json:"scheme"`
-	Port       int              `json:"port"`
-	Exchange   string           `json:"exchange"` // exchange name
-	Channel    string           `json:"channel"`  // channel name
+	amqpconf.Config
+	Brokers          amqpconf.Brokers       `json:"brokers"` // tried in order, instead of the single broker fields
+	mu               sync.Mutex             // serialises publishing so confirmations arrive in order
+	connection       *amqp.Connection       // broker connection object
+	achannel         *amqp.Channel          // default AMQP channel
+	closed           chan *amqp.Error       // connection closed flag
+	confirms         chan amqp.Confirmation // publisher confirmations, if enabled
+	tag              uint64                 // delivery tag of the last message published on this channel
+	Exchange         string                 `json:"exchange"`           // exchange name
+	Channel          string                 `json:"channel"`            // channel name
+	RoutingKeyPrefix string                 `json:"routing-key-prefix"` // messages are routed as <prefix>.<type>
+	Persistent       bool                   `json:"persistent"`         // ask the broker to write messages to disk
+	Confirm          bool                   `json:"confirm"`            // wait for the broker to confirm each message
 }
 
 // connect establishes connection for AMQP broker.
 func (b *broker) connect() error {
 	var err error
-	uri := fmt.Sprintf(
-		"%v://%v:%v@%v:%v/",
-		b.Scheme,
-		b.User,
-		b.Pass,
-		b.Host,
-		b.Port,
-	)
-	if b.connection, err = amqp.Dial(uri); err != nil {
-		log.WithFields(logrus.Fields{
-			"url":   uri,
-			"error": err,
-		}).Warn("error while dialling AMQP broker")
+	var c amqpconf.Config
+	if b.connection, c, err = b.Brokers.Dial(); err != nil {
+		log.WithError(err).Warn("error while dialling AMQP brokers")
 		return errors.Wrap(err, "while dialling AMQP broker")
 	}
+	if c != b.Brokers[0] {
+		log.WithField("url", c.Redacted()).Warn("failed over to a backup AMQP broker")
+	}
 	if b.achannel, err = b.connection.Channel(); err != nil {
 		return errors.Wrap(err, "could not open AMQP channel")
 	}
@@ -56,6 +52,13 @@ func (b *broker) connect() error {
 	); err != nil {
 		return errors.Wrap(err, "could not declare AMQP exchange")
 	}
+	if b.Confirm {
+		if err = b.achannel.Confirm(false); err != nil {
+			return errors.Wrap(err, "could not enable publisher confirms")
+		}
+		b.confirms = b.achannel.NotifyPublish(make(chan amqp.Confirmation, 1))
+		b.tag = 0 // delivery tags restart on every channel
+	}
 	b.closed = make(chan *amqp.Error)
 	b.achannel.NotifyClose(b.closed)
 
@@ -63,33 +66,41 @@ func (b *broker) connect() error {
 }
 
 func (b *broker) validate() error {
-	if b.Host == "" {
-		return errors.New("missing host field")
-	}
-	if b.User == "" {
-		return errors.New("missing user field")
-	}
-	if b.Pass == "" {
-		return errors.New("missing pass field")
+	if len(b.Brokers) == 0 {
+		b.Brokers = amqpconf.Brokers{b.Config}
 	}
-	if b.Scheme == "" {
-		b.Scheme = "amqp"
+	if err := b.Brokers.Validate(); err != nil {
+		return err
 	}
-	if b.Port == 0 {
-		b.Port = 5672
+	if b.Exchange == "" {
+		return errors.New("missing exchange field")
 	}
 	return nil
 }
 
+// routingKey returns the routing key for messages of the given type.
+func (b *broker) routingKey(msgType string) string {
+	if b.RoutingKeyPrefix == "" {
+		return msgType
+	}
+	return b.RoutingKeyPrefix + "." + msgType
+}
+
 func (b *broker) send(ctx context.Context, msg []byte, msgType string) error {
 
 	amqpMsg := amqp.Publishing{
 		DeliveryMode: amqp.Transient,
 		Timestamp:    time.Now(),
-		ContentType:  "text/plain",
+		ContentType:  "application/octet-stream",
 		Type:         msgType,
 		Body:         msg,
 	}
+	if b.Persistent {
+		amqpMsg.DeliveryMode = amqp.Persistent
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
 	// Loop until we successfully publish, permanently fail to connect, or run out of time
 	// Note! The amqp Publish method is blocking and in theory could cause a goroutine leak
@@ -102,12 +113,16 @@ func (b *broker) send(ctx context.Context, msg []byte, msgType string) error {
 				return errors.Wrap(err, "could not connect before publishing to amqp")
 			}
 		default:
-			err := b.achannel.Publish(b.Exchange, "status", false, false, amqpMsg)
+			err := b.achannel.Publish(b.Exchange, b.routingKey(msgType), false, false, amqpMsg)
 			if err == nil {
-				return nil
+				if !b.Confirm {
+					return nil
+				}
+				b.tag++
+				return b.confirmed(ctx, b.tag)
 			}
 			log.WithError(err).
-				WithField("message", msg).
+				WithField("type", msgType).
 				Warn("received error while publishing message")
 			// close the connection so that we can try again cleanly
 			if err := b.connection.Close(); err != nil {
@@ -116,3 +131,25 @@ func (b *broker) send(ctx context.Context, msg []byte, msgType string) error {
 		}
 	}
 }
+
+// confirmed waits for the broker to confirm the message with the given delivery tag. Confirmations for earlier
+// messages whose senders gave up waiting are discarded.
+func (b *broker) confirmed(ctx context.Context, tag uint64) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("deadline expired while waiting for amqp publisher confirm")
+		case c, ok := <-b.confirms:
+			if !ok {
+				return errors.New("amqp channel closed before message was confirmed")
+			}
+			if c.DeliveryTag < tag {
+				continue
+			}
+			if !c.Ack {
+				return errors.New("amqp broker rejected message")
+			}
+			return nil
+		}
+	}
+}
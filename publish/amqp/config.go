@@ -8,31 +8,27 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Broker holds the configuration and state of the AMQP broker
-var Broker = &broker{}
-
 var log *logrus.Entry
 
-func initialise(config json.RawMessage, ll logrus.Level) error {
+func initialise(config json.RawMessage, ll logrus.Level) (publish.Publisher, error) {
 
 	log = logger.New("amqpPublish", ll)
 
 	log.Debug("Initialising publisher")
-	if err := json.Unmarshal(config, Broker); err != nil {
-		return errors.Wrap(err, "could not parse configuration")
+	b := &broker{}
+	if err := json.Unmarshal(config, b); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "could not parse configuration")
 	}
-	if err := Broker.validate(); err != nil {
-		return errors.Wrap(err, "invalid configuration")
+	if err := b.validate(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "invalid configuration")
 	}
 	log.Debug("Connecting to AMQP broker")
-	if err := Broker.connect(); err != nil {
-		return errors.Wrap(err, "error connecting to AMQP broker")
+	if err := b.connect(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "error connecting to AMQP broker")
 	}
-	return nil
+	return publish.Publisher{Status: b.sendStatus, Heartbeat: b.sendHeartbeat}, nil
 }
 
 func init() {
-	publish.RegisterConfigFunction("amqp", initialise)
-	publish.RegisterStatusPublishFunction("amqp", sendStatus)
-	publish.RegisterHeartbeatPublishFunction("amqp", sendHeartbeat)
+	publish.RegisterPublisherFunction("amqp", initialise)
 }
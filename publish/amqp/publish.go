@@ -2,30 +2,16 @@ package amqp
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/alowde/dpoller/heartbeat"
 	"github.com/alowde/dpoller/url/check"
-	"github.com/pkg/errors"
 )
 
-// sendStatus is a thin wrapper around the Broker, turns the status into a []byte + "status" string
-func sendStatus(ctx context.Context, status check.Status) error {
-
-	msg, err := json.Marshal(status)
-	if err != nil {
-		return errors.Wrap(err, "could not serialise message")
-	}
-
-	return Broker.send(ctx, msg, "status")
+// sendStatus is a thin wrapper around the broker, sends the sealed status with a "status" type
+func (b *broker) sendStatus(ctx context.Context, status check.Status, msg []byte) error {
+	return b.send(ctx, msg, "status")
 }
 
-// sendHeartbeat is a thin wrapper around the Broker, turns the status into a []byte + "heartbeat" string
-func sendHeartbeat(ctx context.Context, beat heartbeat.Beat) error {
-
-	msg, err := json.Marshal(beat)
-	if err != nil {
-		return errors.Wrap(err, "could not serialise message")
-	}
-
-	return Broker.send(ctx, msg, "heartbeat")
+// sendHeartbeat is a thin wrapper around the broker, sends the sealed heartbeat with a "heartbeat" type
+func (b *broker) sendHeartbeat(ctx context.Context, beat heartbeat.Beat, msg []byte) error {
+	return b.send(ctx, msg, "heartbeat")
 }
@@ -0,0 +1,34 @@
+package kafka
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/publish"
+	"github.com/pkg/errors"
+)
+
+var log *logrus.Entry
+
+func initialise(config json.RawMessage, ll logrus.Level) (publish.Publisher, error) {
+
+	log = logger.New("kafkaPublish", ll)
+
+	log.Debug("Initialising publisher")
+	p := &producer{}
+	if err := json.Unmarshal(config, p); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "could not parse configuration")
+	}
+	if err := p.validate(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "invalid configuration")
+	}
+	log.Debug("Connecting to Kafka brokers")
+	if err := p.connect(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "error connecting to Kafka brokers")
+	}
+	return publish.Publisher{Status: p.sendStatus, Heartbeat: p.sendHeartbeat}, nil
+}
+
+func init() {
+	publish.RegisterPublisherFunction("kafka", initialise)
+}
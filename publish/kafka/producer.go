@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"context"
+	"github.com/Shopify/sarama"
+	"github.com/alowde/dpoller/pkg/tlsconf"
+	"github.com/pkg/errors"
+	"time"
+)
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// producer contains all of the information required to write to a Kafka cluster.
+type producer struct {
+	async          sarama.AsyncProducer
+	Brokers        []string       `json:"brokers"`         // host:port of one or more bootstrap brokers
+	Version        string         `json:"version"`         // Kafka protocol version, e.g. "2.1.0"
+	StatusTopic    string         `json:"status-topic"`    // topic for statuses, keyed by check name
+	HeartbeatTopic string         `json:"heartbeat-topic"` // topic for heartbeats, keyed by node ID
+	Compression    string         `json:"compression"`     // none, gzip, snappy, lz4 or zstd
+	BatchSize      int            `json:"batch-size"`      // messages buffered before a batch is sent
+	BatchInterval  int            `json:"batch-interval"`  // milliseconds before a partial batch is sent
+	TLS            tlsconf.Config `json:"tls"`
+}
+
+func (p *producer) validate() error {
+	if len(p.Brokers) == 0 {
+		return errors.New("missing brokers field")
+	}
+	if p.Version == "" {
+		p.Version = "2.1.0"
+	}
+	if p.StatusTopic == "" {
+		p.StatusTopic = "dpoller-status"
+	}
+	if p.HeartbeatTopic == "" {
+		p.HeartbeatTopic = "dpoller-heartbeat"
+	}
+	if p.Compression == "" {
+		p.Compression = "snappy"
+	}
+	if _, ok := compressionCodecs[p.Compression]; !ok {
+		return errors.Errorf("unknown compression %q", p.Compression)
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = 100
+	}
+	if p.BatchInterval <= 0 {
+		p.BatchInterval = 500
+	}
+	return nil
+}
+
+// connect creates an asynchronous producer. Messages are batched by the client and delivery errors are reported by
+// a background routine, so a successful send means the message was accepted for delivery rather than delivered.
+func (p *producer) connect() error {
+	version, err := sarama.ParseKafkaVersion(p.Version)
+	if err != nil {
+		return errors.Wrap(err, "invalid version")
+	}
+	c := sarama.NewConfig()
+	c.ClientID = "dpoller"
+	c.Version = version
+	c.Producer.RequiredAcks = sarama.WaitForLocal
+	c.Producer.Compression = compressionCodecs[p.Compression]
+	c.Producer.Flush.Messages = p.BatchSize
+	c.Producer.Flush.Frequency = time.Duration(p.BatchInterval) * time.Millisecond
+	c.Producer.Return.Successes = false
+	c.Producer.Return.Errors = true
+	if p.TLS.Enabled() {
+		c.Net.TLS.Enable = true
+		if c.Net.TLS.Config, err = p.TLS.Build(); err != nil {
+			return errors.Wrap(err, "invalid TLS configuration")
+		}
+	}
+	if p.async, err = sarama.NewAsyncProducer(p.Brokers, c); err != nil {
+		return errors.Wrap(err, "could not create Kafka producer")
+	}
+	go func() {
+		for e := range p.async.Errors() {
+			log.WithError(e.Err).
+				WithField("topic", e.Msg.Topic).
+				Warn("failed to deliver message to Kafka")
+		}
+	}()
+	return nil
+}
+
+// send queues a message for the given topic and key.
+func (p *producer) send(ctx context.Context, topic, key string, msg []byte) error {
+	select {
+	case p.async.Input() <- &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(msg),
+	}:
+		return nil
+	case <-ctx.Done():
+		return errors.New("deadline expired while queueing message for Kafka")
+	}
+}
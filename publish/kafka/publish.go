@@ -0,0 +1,18 @@
+package kafka
+
+import (
+	"context"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+	"strconv"
+)
+
+// sendStatus is a thin wrapper around the producer, keys the status by check name so a check's results stay in order
+func (p *producer) sendStatus(ctx context.Context, status check.Status, msg []byte) error {
+	return p.send(ctx, p.StatusTopic, status.Url.Name, msg)
+}
+
+// sendHeartbeat is a thin wrapper around the producer, keys the heartbeat by node ID so a node's beats stay in order
+func (p *producer) sendHeartbeat(ctx context.Context, beat heartbeat.Beat, msg []byte) error {
+	return p.send(ctx, p.HeartbeatTopic, strconv.FormatInt(beat.ID, 10), msg)
+}
@@ -0,0 +1,133 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/node"
+	"github.com/alowde/dpoller/pkg/tlsconf"
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// broker contains all of the information required to connect to an MQTT broker.
+type broker struct {
+	mu          sync.Mutex // guards client, which is replaced on every reconnection
+	client      mqtt.Client
+	URL         string         `json:"url"`          // e.g. tcp://host:1883 or ssl://host:8883
+	User        string         `json:"user"`         // optional username
+	Pass        string         `json:"pass"`         // optional password
+	ClientID    string         `json:"client-id"`    // defaults to a name derived from the node ID
+	TopicPrefix string         `json:"topic-prefix"` // messages are sent below <prefix>/
+	QoS         byte           `json:"qos"`          // 0, 1 or 2
+	TLS         tlsconf.Config `json:"tls"`
+}
+
+func (b *broker) validate() error {
+	if b.URL == "" {
+		return errors.New("missing url field")
+	}
+	if b.QoS > 2 {
+		return errors.New("qos must be 0, 1 or 2")
+	}
+	if b.TopicPrefix == "" {
+		b.TopicPrefix = "dpoller"
+	}
+	if b.ClientID == "" {
+		b.ClientID = fmt.Sprintf("dpoller-pub-%x", node.Self.ID)
+	}
+	return nil
+}
+
+// statusTopic returns the topic all statuses are published on.
+func (b *broker) statusTopic() string {
+	return b.TopicPrefix + "/status"
+}
+
+// heartbeatTopic returns the topic this node's heartbeats are published on. Each node has its own topic so the broker
+// can retain the last heartbeat of every node.
+func (b *broker) heartbeatTopic() string {
+	return fmt.Sprintf("%v/heartbeat/%v", b.TopicPrefix, node.Self.ID)
+}
+
+// connect establishes a connection to the MQTT broker, registering an obituary as the last will so the broker
+// announces this node's death as soon as it notices the connection has gone. The will is retained so it replaces this
+// node's last heartbeat, and listeners clear it once they've seen it. The will is sealed afresh for every connection,
+// as listeners discard an obituary they've already seen, so paho's own reconnection isn't used.
+func (b *broker) connect() error {
+	will, err := envelope.Seal(heartbeat.NewObituary())
+	if err != nil {
+		return errors.Wrap(err, "could not seal last will")
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.URL).
+		SetClientID(b.ClientID).
+		SetProtocolVersion(4). // MQTT 3.1.1
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetBinaryWill(b.heartbeatTopic(), will, b.QoS, true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.WithError(err).Warn("lost connection to MQTT broker, reconnecting")
+			go b.reconnect()
+		})
+	if b.User != "" {
+		opts.SetUsername(b.User)
+		opts.SetPassword(b.Pass)
+	}
+	if b.TLS.Enabled() {
+		t, err := b.TLS.Build()
+		if err != nil {
+			return errors.Wrap(err, "invalid TLS configuration")
+		}
+		opts.SetTLSConfig(t)
+	}
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(30 * time.Second) {
+		return errors.New("timed out connecting to MQTT broker")
+	}
+	if err := token.Error(); err != nil {
+		return errors.Wrap(err, "while connecting to MQTT broker")
+	}
+	b.mu.Lock()
+	b.client = client
+	b.mu.Unlock()
+	return nil
+}
+
+// reconnect retries connecting with exponential backoff until it succeeds.
+func (b *broker) reconnect() {
+	wait := time.Second
+	for {
+		err := b.connect()
+		if err == nil {
+			log.Info("reconnected to MQTT broker")
+			return
+		}
+		log.WithError(err).WithField("retry in", wait).Warn("could not reconnect to MQTT broker")
+		time.Sleep(wait)
+		if wait *= 2; wait > time.Minute {
+			wait = time.Minute
+		}
+	}
+}
+
+// send publishes a message and, for QoS above zero, waits for the broker to acknowledge it.
+func (b *broker) send(ctx context.Context, topic string, msg []byte, retained bool) error {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	if !client.IsConnectionOpen() {
+		return errors.New("not connected to MQTT broker")
+	}
+	token := client.Publish(topic, b.QoS, retained, msg)
+	select {
+	case <-ctx.Done():
+		return errors.New("deadline expired while publishing to MQTT")
+	case <-token.Done():
+		return errors.Wrap(token.Error(), "while publishing to MQTT")
+	}
+}
@@ -0,0 +1,34 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/publish"
+	"github.com/pkg/errors"
+)
+
+var log *logrus.Entry
+
+func initialise(config json.RawMessage, ll logrus.Level) (publish.Publisher, error) {
+
+	log = logger.New("mqttPublish", ll)
+
+	log.Debug("Initialising publisher")
+	b := &broker{}
+	if err := json.Unmarshal(config, b); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "could not parse configuration")
+	}
+	if err := b.validate(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "invalid configuration")
+	}
+	log.Debug("Connecting to MQTT broker")
+	if err := b.connect(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "error connecting to MQTT broker")
+	}
+	return publish.Publisher{Status: b.sendStatus, Heartbeat: b.sendHeartbeat}, nil
+}
+
+func init() {
+	publish.RegisterPublisherFunction("mqtt", initialise)
+}
@@ -0,0 +1,18 @@
+package mqtt
+
+import (
+	"context"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+)
+
+// sendStatus is a thin wrapper around the broker, sends the sealed status on the shared status topic
+func (b *broker) sendStatus(ctx context.Context, status check.Status, msg []byte) error {
+	return b.send(ctx, b.statusTopic(), msg, false)
+}
+
+// sendHeartbeat is a thin wrapper around the broker, sends the sealed heartbeat on this node's retained heartbeat
+// topic
+func (b *broker) sendHeartbeat(ctx context.Context, beat heartbeat.Beat, msg []byte) error {
+	return b.send(ctx, b.heartbeatTopic(), msg, true)
+}
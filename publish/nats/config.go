@@ -0,0 +1,34 @@
+package nats
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/publish"
+	"github.com/pkg/errors"
+)
+
+var log *logrus.Entry
+
+func initialise(config json.RawMessage, ll logrus.Level) (publish.Publisher, error) {
+
+	log = logger.New("natsPublish", ll)
+
+	log.Debug("Initialising publisher")
+	s := &server{}
+	if err := json.Unmarshal(config, s); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "could not parse configuration")
+	}
+	if err := s.validate(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "invalid configuration")
+	}
+	log.Debug("Connecting to NATS server")
+	if err := s.connect(); err != nil {
+		return publish.Publisher{}, errors.Wrap(err, "error connecting to NATS server")
+	}
+	return publish.Publisher{Status: s.sendStatus, Heartbeat: s.sendHeartbeat, Statuses: s.sendStatuses}, nil
+}
+
+func init() {
+	publish.RegisterPublisherFunction("nats", initialise)
+}
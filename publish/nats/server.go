@@ -0,0 +1,95 @@
+package nats
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// server contains all of the information required to connect to a NATS server or cluster.
+type server struct {
+	conn          *nats.Conn // server connection object
+	URL           string     `json:"url"`            // one or more comma-separated server URLs
+	SubjectPrefix string     `json:"subject-prefix"` // messages are sent to <prefix>.status and <prefix>.heartbeat
+	Token         string     `json:"token"`          // optional token authentication
+	NkeySeedFile  string     `json:"nkey-seed-file"` // optional nkey authentication
+	MaxReconnects int        `json:"max-reconnects"` // reconnect attempts before giving up, negative for unlimited
+	ReconnectWait int        `json:"reconnect-wait"` // seconds between reconnect attempts
+}
+
+func (s *server) validate() error {
+	if s.URL == "" {
+		return errors.New("missing url field")
+	}
+	if s.Token != "" && s.NkeySeedFile != "" {
+		return errors.New("token and nkey-seed-file are mutually exclusive")
+	}
+	if s.SubjectPrefix == "" {
+		s.SubjectPrefix = "dpoller"
+	}
+	if s.MaxReconnects == 0 {
+		s.MaxReconnects = -1
+	}
+	if s.ReconnectWait <= 0 {
+		s.ReconnectWait = 2
+	}
+	return nil
+}
+
+// connect establishes a connection to the NATS server. The client library handles reconnection itself, buffering
+// published messages while it does so.
+func (s *server) connect() error {
+	opts := []nats.Option{
+		nats.Name("dpoller publisher"),
+		nats.MaxReconnects(s.MaxReconnects),
+		nats.ReconnectWait(time.Duration(s.ReconnectWait) * time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.WithError(err).Warn("disconnected from NATS server")
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.WithField("server", c.ConnectedUrl()).Info("reconnected to NATS server")
+		}),
+		nats.ClosedHandler(func(_ *nats.Conn) {
+			log.Warn("NATS connection closed, no further reconnects will be attempted")
+		}),
+	}
+	if s.Token != "" {
+		opts = append(opts, nats.Token(s.Token))
+	}
+	if s.NkeySeedFile != "" {
+		o, err := nats.NkeyOptionFromSeed(s.NkeySeedFile)
+		if err != nil {
+			return errors.Wrap(err, "could not load nkey seed")
+		}
+		opts = append(opts, o)
+	}
+	var err error
+	if s.conn, err = nats.Connect(s.URL, opts...); err != nil {
+		return errors.Wrap(err, "while connecting to NATS server")
+	}
+	return nil
+}
+
+// subject returns the subject that messages of the given type are published on.
+func (s *server) subject(msgType string) string {
+	return s.SubjectPrefix + "." + msgType
+}
+
+// send publishes messages and waits for the server to acknowledge they have been processed, so that a disconnected
+// server is reported as a failure rather than silently buffered.
+func (s *server) send(ctx context.Context, msgType string, msgs ...[]byte) error {
+	if s.conn.IsClosed() {
+		return errors.New("NATS connection is closed")
+	}
+	for _, msg := range msgs {
+		if err := s.conn.Publish(s.subject(msgType), msg); err != nil {
+			return errors.Wrap(err, "while publishing to NATS")
+		}
+	}
+	// A single flush acknowledges everything published before it
+	if err := s.conn.FlushWithContext(ctx); err != nil {
+		return errors.Wrap(err, "NATS server did not acknowledge message before deadline")
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/url/check"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// pipelineConfig describes how statuses published asynchronously are queued and batched. It's read from the reserved
+// "pipeline" key of the publishers configuration.
+type pipelineConfig struct {
+	QueueSize     int    `json:"queue-size"`     // statuses queued per transport before the overflow policy applies
+	BatchSize     int    `json:"batch-size"`     // statuses sent together once this many are queued...
+	BatchInterval int    `json:"batch-interval"` // ...or once this many milliseconds have passed
+	Overflow      string `json:"overflow"`       // "drop-oldest" (default), "drop-newest" or "block"
+	SendTimeout   int    `json:"send-timeout"`   // seconds allowed for a transport to send a batch
+}
+
+var pipeConf = pipelineConfig{
+	QueueSize:     1000,
+	BatchSize:     50,
+	BatchInterval: 500,
+	Overflow:      "drop-oldest",
+	SendTimeout:   10,
+}
+
+// Pipeline counts statuses passing through the asynchronous pipeline by transport and outcome, along with the current
+// depth of each transport's queue.
+var Pipeline = expvar.NewMap("publish_pipeline")
+
+// ErrDropped is returned by PublishAsync when a status is discarded because a transport's queue is full.
+var ErrDropped = errors.New("publish queue full, status dropped")
+
+// sealed is a queued status along with the message it was sealed into.
+type sealed struct {
+	status check.Status
+	msg    []byte
+}
+
+// worker delivers queued statuses to a single transport, so a slow or unavailable transport can't delay the others.
+type worker struct {
+	name   string
+	conf   pipelineConfig
+	queue  chan sealed
+	single statusPublishFunction
+	batch  statusBatchPublishFunction // nil if the transport doesn't provide one
+}
+
+var workers []*worker
+
+// configurePipeline parses the pipeline configuration, which may be nil if none was provided.
+func configurePipeline(config json.RawMessage) error {
+	if config != nil {
+		if err := json.Unmarshal(config, &pipeConf); err != nil {
+			return errors.Wrap(err, "could not parse pipeline configuration")
+		}
+	}
+	switch pipeConf.Overflow {
+	case "drop-oldest", "drop-newest", "block":
+	default:
+		return errors.Errorf("unknown overflow policy %q, expected drop-oldest, drop-newest or block", pipeConf.Overflow)
+	}
+	if pipeConf.QueueSize <= 0 || pipeConf.BatchSize <= 0 || pipeConf.BatchInterval <= 0 || pipeConf.SendTimeout <= 0 {
+		return errors.New("queue-size, batch-size, batch-interval and send-timeout must be positive")
+	}
+	return nil
+}
+
+// newWorker returns a worker for a publisher, ready to run.
+func newWorker(name string, p Publisher) *worker {
+	w := &worker{
+		name:   name,
+		conf:   pipeConf,
+		queue:  make(chan sealed, pipeConf.QueueSize),
+		single: p.Status,
+		batch:  p.Statuses,
+	}
+	Pipeline.Set(name+".depth", expvar.Func(func() interface{} { return len(w.queue) }))
+	return w
+}
+
+// startWorkers starts a worker for each configured publisher that publishes statuses.
+func startWorkers() {
+	for name, p := range publishers {
+		if p.Status == nil {
+			continue
+		}
+		w := newWorker(name, p)
+		workers = append(workers, w)
+		go w.run()
+	}
+	log.WithFields(logrus.Fields{
+		"workers":  len(workers),
+		"overflow": pipeConf.Overflow,
+	}).Debug("Started publish pipeline")
+}
+
+// PublishAsync delivers a status locally and queues it for every transport, returning without waiting for it to be
+// sent. Unless the overflow policy is "block", a transport that can't keep up has statuses dropped rather than
+// delaying the caller, and ErrDropped is returned. The status is sealed once here so that every transport sends the
+// same message.
+func PublishAsync(status check.Status) error {
+	schan <- status
+	msg, err := seal(status)
+	if err != nil {
+		return errors.Wrap(err, "could not seal message")
+	}
+	for _, w := range workers {
+		if !w.enqueue(sealed{status, msg}) {
+			err = ErrDropped
+		}
+	}
+	return err
+}
+
+// enqueue adds a status to the worker's queue according to the overflow policy, returning false if a status had to be
+// dropped.
+func (w *worker) enqueue(s sealed) bool {
+	Pipeline.Add(w.name+".queued", 1)
+	switch w.conf.Overflow {
+	case "block":
+		w.queue <- s
+		return true
+	case "drop-newest":
+		select {
+		case w.queue <- s:
+			return true
+		default:
+			Pipeline.Add(w.name+".dropped", 1)
+			return false
+		}
+	}
+	ok := true
+	for {
+		select {
+		case w.queue <- s:
+			return ok
+		default:
+		}
+		// Make room by discarding the oldest status, unless the worker has just done so for us
+		select {
+		case <-w.queue:
+			Pipeline.Add(w.name+".dropped", 1)
+			ok = false
+		default:
+		}
+	}
+}
+
+// run collects queued statuses into batches, sending each once it's full or the batch interval has passed.
+func (w *worker) run() {
+	ticker := time.NewTicker(time.Duration(w.conf.BatchInterval) * time.Millisecond)
+	defer ticker.Stop()
+	batch := make([]sealed, 0, w.conf.BatchSize)
+	for {
+		select {
+		case s := <-w.queue:
+			batch = append(batch, s)
+			if len(batch) < w.conf.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		w.flush(batch)
+		batch = make([]sealed, 0, w.conf.BatchSize)
+	}
+}
+
+// flush sends a batch with the publisher's batch function if it has one, or one status at a time otherwise.
+func (w *worker) flush(batch []sealed) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.conf.SendTimeout)*time.Second)
+	defer cancel()
+	Pipeline.Add(w.name+".batches", 1)
+
+	var failed int
+	var err error
+	if w.batch != nil {
+		statuses := make([]check.Status, len(batch))
+		msgs := make([][]byte, len(batch))
+		for i, s := range batch {
+			statuses[i], msgs[i] = s.status, s.msg
+		}
+		if err = w.batch(ctx, statuses, msgs); err != nil {
+			failed = len(batch)
+		}
+	} else {
+		for _, s := range batch {
+			if e := w.single(ctx, s.status, s.msg); e != nil {
+				failed++
+				err = e
+			}
+		}
+	}
+	Pipeline.Add(w.name+".sent", int64(len(batch)-failed))
+	if failed > 0 {
+		Pipeline.Add(w.name+".failed", int64(failed))
+		log.WithError(err).WithFields(logrus.Fields{
+			"publisher": w.name,
+			"failed":    failed,
+			"batch":     len(batch),
+		}).Warn("failed to publish statuses")
+	}
+}
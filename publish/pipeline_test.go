@@ -0,0 +1,153 @@
+package publish
+
+import (
+	"context"
+	"expvar"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/url/check"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a fake transport that records the batches it's asked to send, optionally blocking until released.
+type recorder struct {
+	sync.Mutex
+	batches [][]check.Status
+	entered chan struct{} // signalled when a send starts, before it blocks
+	release chan struct{}
+	sent    chan struct{} // signalled when a batch has been recorded
+}
+
+func newRecorder(blocking bool) *recorder {
+	r := &recorder{entered: make(chan struct{}, 100), sent: make(chan struct{}, 100)}
+	if blocking {
+		r.release = make(chan struct{})
+	}
+	return r
+}
+
+func (r *recorder) send(ctx context.Context, statuses []check.Status) error {
+	r.entered <- struct{}{}
+	if r.release != nil {
+		<-r.release
+	}
+	r.Lock()
+	r.batches = append(r.batches, statuses)
+	r.Unlock()
+	r.sent <- struct{}{}
+	return nil
+}
+
+// wait waits for n signals on a channel, failing the test if they don't arrive in good time.
+func wait(t *testing.T, c chan struct{}, n int, what string) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %v %v of %v", what, i+1, n)
+		}
+	}
+}
+
+// stubSeal replaces the seal function, which the envelope package provides, returning a function that restores it.
+func stubSeal() func() {
+	f := seal
+	seal = func(i interface{}) ([]byte, error) { return nil, nil }
+	return func() { seal = f }
+}
+
+func counter(key string) int64 {
+	if v, ok := Pipeline.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// setup resets the pipeline with a single fake transport. Its worker isn't started, so the test can fill the queue
+// first and the batches sent don't depend on scheduling.
+func setup(t *testing.T, name string, conf pipelineConfig, r *recorder) *worker {
+	log = logger.New("publish", logrus.FatalLevel)
+	schan = make(chan check.Status, 100)
+	pipeConf = conf
+	w := newWorker(name, Publisher{
+		Status: func(ctx context.Context, s check.Status, _ []byte) error {
+			return r.send(ctx, []check.Status{s})
+		},
+		Statuses: func(ctx context.Context, statuses []check.Status, _ [][]byte) error {
+			return r.send(ctx, statuses)
+		},
+	})
+	workers = []*worker{w}
+	return w
+}
+
+func TestBatching(t *testing.T) {
+	defer stubSeal()()
+	r := newRecorder(false)
+	w := setup(t, "batching", pipelineConfig{QueueSize: 100, BatchSize: 4, BatchInterval: 100,
+		Overflow: "drop-oldest", SendTimeout: 1}, r)
+
+	for i := 0; i < 10; i++ {
+		if err := PublishAsync(check.Status{StatusCode: i}); err != nil {
+			t.Fatalf("Received error %v", err)
+		}
+	}
+	go w.run()
+	wait(t, r.sent, 3, "batch")
+
+	// Two full batches followed by the remainder once the interval passed
+	r.Lock()
+	defer r.Unlock()
+	if len(r.batches) != 3 || len(r.batches[0]) != 4 || len(r.batches[2]) != 2 {
+		t.Errorf("Error in PublishAsync(), unexpected batches %v", r.batches)
+	}
+	if r.batches[2][1].StatusCode != 9 {
+		t.Errorf("Error in PublishAsync(), statuses were reordered")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	defer stubSeal()()
+	tables := []struct {
+		policy string
+		first  int // status code of the first status sent once the transport recovers
+	}{
+		{"drop-oldest", 7},
+		{"drop-newest", 1},
+	}
+	for _, table := range tables {
+		r := newRecorder(true)
+		name := "overflow-" + table.policy
+		w := setup(t, name, pipelineConfig{QueueSize: 3, BatchSize: 1, BatchInterval: 100, Overflow: table.policy,
+			SendTimeout: 1}, r)
+		go w.run()
+
+		before := counter(name + ".dropped")
+
+		// The first status is taken by the worker, which then blocks, leaving three queue slots for nine statuses
+		_ = PublishAsync(check.Status{StatusCode: 0})
+		wait(t, r.entered, 1, "send")
+		var dropped int
+		for i := 1; i < 10; i++ {
+			if err := PublishAsync(check.Status{StatusCode: i}); err == ErrDropped {
+				dropped++
+			}
+		}
+		if dropped != 6 {
+			t.Errorf("Error in PublishAsync() for policy %v, expected 6 drops, got %v", table.policy, dropped)
+		}
+		close(r.release)
+		wait(t, r.sent, 4, "batch")
+
+		r.Lock()
+		if len(r.batches) != 4 || r.batches[1][0].StatusCode != table.first {
+			t.Errorf("Error in PublishAsync() for policy %v, unexpected batches %v", table.policy, r.batches)
+		}
+		r.Unlock()
+		if n := counter(name+".dropped") - before; n != 6 {
+			t.Errorf("Error in PublishAsync() for policy %v, expected 6 drops counted, got %v", table.policy, n)
+		}
+	}
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/alowde/dpoller/logger"
 	"github.com/alowde/dpoller/url/check"
 	"github.com/pkg/errors"
-	"sync"
+	"strings"
 	"time"
 )
 
@@ -19,24 +19,83 @@ var hchan chan heartbeat.Beat // channel for internally publishing heartbeats
 var log *logrus.Entry
 
 type configParseFunction func(message json.RawMessage, ll logrus.Level) error
-type statusPublishFunction func(ctx context.Context, status check.Status) error
-type heartbeatPublishFunction func(ctx context.Context, beat heartbeat.Beat) error
+type publisherFunction func(message json.RawMessage, ll logrus.Level) (Publisher, error)
+type statusPublishFunction func(ctx context.Context, status check.Status, msg []byte) error
+type statusBatchPublishFunction func(ctx context.Context, statuses []check.Status, msgs [][]byte) error
+type heartbeatPublishFunction func(ctx context.Context, beat heartbeat.Beat, msg []byte) error
+type sealFunction func(i interface{}) ([]byte, error)
 
+// Publisher holds the functions used to send messages through one configured instance of a publisher module. Each is
+// passed the message already sealed along with the value it was sealed from, which is there for transports that route
+// by its content. Every publisher sends the same sealed bytes, so a receiver recognises a copy that arrived by another
+// path as a duplicate; a publisher must send them as they are rather than sealing the value again.
+type Publisher struct {
+	Status    statusPublishFunction
+	Heartbeat heartbeatPublishFunction
+	Statuses  statusBatchPublishFunction // optional, sends several statuses more efficiently than calling Status
+}
+
+var publisherFunctions = make(map[string]publisherFunction)
 var configParseFunctions = make(map[string]configParseFunction)
-var statusPublishFunctions = make(map[string]statusPublishFunction)
-var heartbeatPublishFunctions = make(map[string]heartbeatPublishFunction)
 
-// RegisterConfigFunction is called as a side-effect of importing a publisher module. It accepts a lambda that will have
-// all related configuration passed to it, as well as channels for publishing internal messages.
+// legacy holds the functions registered by modules using the deprecated registration functions, by module name. They
+// only become publishers once the module's configuration succeeds.
+var legacy = make(map[string]Publisher)
+
+// publishers holds every configured instance by the name of its configuration key.
+var publishers = make(map[string]Publisher)
+
+// RegisterPublisherFunction is called as a side-effect of importing a publisher module. It accepts a lambda that will
+// have all related configuration passed to it and returns the functions used to publish through the configured
+// instance. A module may be configured more than once using keys of the form "<name>:<instance>", e.g. "amqp:backup",
+// and the lambda is called once for each.
+func RegisterPublisherFunction(name string, f publisherFunction) {
+	publisherFunctions[name] = f
+}
+
+// RegisterConfigFunction registers a lambda that will have all related configuration passed to it. The module publishes
+// through the functions it registers under the same name with RegisterStatusPublishFunction and
+// RegisterHeartbeatPublishFunction, and can only be configured once.
+//
+// Deprecated: use RegisterPublisherFunction instead.
 func RegisterConfigFunction(name string, f configParseFunction) {
 	configParseFunctions[name] = f
 }
 
-func RegisterStatusPublishFunction(name string, f statusPublishFunction) {
-	statusPublishFunctions[name] = f
+// seal turns a message into the bytes every publisher sends. It's provided by the envelope package, which can't be
+// imported here because it depends on packages that publish.
+var seal sealFunction = func(i interface{}) ([]byte, error) {
+	return nil, errors.New("no seal function registered")
 }
-func RegisterHeartbeatPublishFunction(name string, f heartbeatPublishFunction) {
-	heartbeatPublishFunctions[name] = f
+
+// RegisterSealFunction is called as a side-effect of importing the envelope package to provide the function used to
+// seal messages before they're published.
+func RegisterSealFunction(f sealFunction) {
+	seal = f
+}
+
+// RegisterStatusPublishFunction adds a function that publishes statuses under the given name.
+//
+// Deprecated: return a Publisher from the lambda passed to RegisterPublisherFunction instead. A function registered
+// here seals statuses itself, so copies it sends aren't recognised as duplicates of those sent by other publishers.
+func RegisterStatusPublishFunction(name string, f func(ctx context.Context, status check.Status) error) {
+	p := legacy[name]
+	p.Status = func(ctx context.Context, status check.Status, _ []byte) error {
+		return f(ctx, status)
+	}
+	legacy[name] = p
+}
+
+// RegisterHeartbeatPublishFunction adds a function that publishes heartbeats under the given name.
+//
+// Deprecated: return a Publisher from the lambda passed to RegisterPublisherFunction instead. A function registered
+// here seals heartbeats itself, so copies it sends aren't recognised as duplicates of those sent by other publishers.
+func RegisterHeartbeatPublishFunction(name string, f func(ctx context.Context, beat heartbeat.Beat) error) {
+	p := legacy[name]
+	p.Heartbeat = func(ctx context.Context, beat heartbeat.Beat, _ []byte) error {
+		return f(ctx, beat)
+	}
+	legacy[name] = p
 }
 
 func Initialise(config json.RawMessage, hc chan heartbeat.Beat, sc chan check.Status, ll logrus.Level) error {
@@ -53,45 +112,82 @@ func Initialise(config json.RawMessage, hc chan heartbeat.Beat, sc chan check.St
 		return errors.Wrap(err, "could not parse publisher configuration collection")
 	}
 
+	// The pipeline key is reserved for the asynchronous publish pipeline rather than a publisher module
+	if err := configurePipeline(C["pipeline"]); err != nil {
+		return err
+	}
+	delete(C, "pipeline")
+
 	// Iterate over configs received and pass them to registered modules
-	var hasOkPublisher bool
-	for publisherName, rawConfig := range C {
+	publishers = make(map[string]Publisher)
+	var configured = make(map[string]bool)
+	for key, rawConfig := range C {
 
 		// If we don't have any publisher plugins by this name then skip it
-		if _, ok := configParseFunctions[publisherName]; !ok {
-			log.WithField("config name", publisherName).
+		publisherName := strings.SplitN(key, ":", 2)[0]
+		p, ok, err := configure(key, publisherName, rawConfig, ll)
+		if !ok {
+			log.WithField("config name", key).
 				Warn("Found unused publisher config")
 			continue
 		}
-
-		// Call the provided configuration
-		log.WithField("name", publisherName).
-			Debug("Configuring publisher module")
-		err := configParseFunctions[publisherName](rawConfig, ll)
 		if err != nil {
-			log.WithField("name", publisherName).
+			log.WithField("name", key).
 				WithField("received error", err).
 				Warn("Received an error while providing configuration to publisher module")
 			continue
 		}
-		hasOkPublisher = true
-		delete(configParseFunctions, publisherName)
+		if p.Status == nil && p.Heartbeat == nil {
+			log.WithField("name", key).
+				Warn("Publisher module provided no publish functions")
+			continue
+		}
+		publishers[key] = p
+		configured[publisherName] = true
 	}
 
 	// Any configuration functions left haven't been successfully initialised
+	for publisherName := range publisherFunctions {
+		if !configured[publisherName] {
+			log.WithField("publisher name", publisherName).
+				Warn("Publisher module found no config")
+		}
+	}
 	for publisherName := range configParseFunctions {
-		log.WithField("publisher name", publisherName).
-			Warn("Publisher module found no config")
+		if !configured[publisherName] {
+			log.WithField("publisher name", publisherName).
+				Warn("Publisher module found no config")
+		}
 	}
 
-	if hasOkPublisher {
-		log.Debug("Configured publishers")
+	if len(publishers) > 0 {
+		log.WithField("publishers", len(publishers)).Debug("Configured publishers")
+		startWorkers()
 		return nil
 	}
 
 	return errors.New("No configuration matched known publisher modules")
 }
 
+// configure passes an instance's configuration to its module and returns the functions to publish through it. ok is
+// false if no module of that name is registered.
+func configure(key, publisherName string, config json.RawMessage, ll logrus.Level) (p Publisher, ok bool, err error) {
+	log.WithField("name", key).
+		Debug("Configuring publisher module")
+	if f, ok := publisherFunctions[publisherName]; ok {
+		p, err = f(config, ll)
+		return p, true, err
+	}
+	f, ok := configParseFunctions[publisherName]
+	if !ok {
+		return Publisher{}, false, nil
+	}
+	if key != publisherName {
+		return Publisher{}, true, errors.New("modules using the deprecated registration can only be configured once")
+	}
+	return legacy[publisherName], true, f(config, ll)
+}
+
 func Publish(ctx context.Context, i interface{}) error {
 
 	switch v := i.(type) {
@@ -112,115 +208,88 @@ func Publish(ctx context.Context, i interface{}) error {
 	}
 }
 
+// distributeHeartbeats seals a heartbeat once and sends the result through every publisher.
 func distributeHeartbeats(ctx context.Context, beat heartbeat.Beat) error {
-
-	var aggResult = make(chan error, len(heartbeatPublishFunctions))
-	var wg sync.WaitGroup
-
-	// Reserve 250ms so publish modules return before the deadline
-	deadline, ok := ctx.Deadline()
-	if !ok {
-		return errors.New("Invalid context provided to publish function")
-	}
-	timeLeft := deadline.Sub(time.Now().Add(250 * time.Millisecond))
-	childCtx, cancel := context.WithTimeout(ctx, timeLeft)
-	defer cancel()
-
-	// Call each publish function in parallel and return the results to a buffered channel.
-	for _, f := range heartbeatPublishFunctions {
-		currentF := f
-		wg.Add(1)
-		go func(ctx context.Context, beat heartbeat.Beat) {
-			aggResult <- currentF(ctx, beat)
-			wg.Done()
-		}(childCtx, beat)
+	msg, err := seal(beat)
+	if err != nil {
+		return errors.Wrap(err, "could not seal message")
 	}
-
-	// Wait until either context expires or all routines return
-	routinesDone := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(routinesDone)
-	}()
-	select {
-	case <-routinesDone:
-	case <-ctx.Done():
-		if len(heartbeatPublishFunctions) == 0 {
-			return errors.New("No publish functions succeeded before deadline expired")
+	sends := make(map[string]func(ctx context.Context) error)
+	for name, p := range publishers {
+		if f := p.Heartbeat; f != nil {
+			sends[name] = func(ctx context.Context) error { return f(ctx, beat, msg) }
 		}
-		// Some publish functions timed out. Should this be an error? Currently is not.
-		log.Warn("Not all publish functions responded before deadline expired")
 	}
+	return distribute(ctx, sends)
+}
 
-	// Declare a slice with the underlying array the size of our total number of results. This lets us count the number
-	// of non-nil responses easily
-	var es = make([]error, 0, len(heartbeatPublishFunctions))
-	for i := 0; i < len(heartbeatPublishFunctions); i++ {
-		if e := <-aggResult; e != nil {
-			log.WithError(e).Warn("Received publish function error")
-			es = append(es, e)
-		}
+// distributeStatuses seals a status once and sends the result through every publisher.
+func distributeStatuses(ctx context.Context, status check.Status) error {
+	msg, err := seal(status)
+	if err != nil {
+		return errors.Wrap(err, "could not seal message")
 	}
-	// Some functions failed. Should this be an error? Currently is.
-	if len(es) > 0 {
-		return errors.New("Some publish functions failed")
+	sends := make(map[string]func(ctx context.Context) error)
+	for name, p := range publishers {
+		if f := p.Status; f != nil {
+			sends[name] = func(ctx context.Context) error { return f(ctx, status, msg) }
+		}
 	}
-	return nil
+	return distribute(ctx, sends)
 }
 
-func distributeStatuses(ctx context.Context, status check.Status) error {
+// distribute calls each publisher's send function in parallel. Publishers are redundant paths to the rest of the
+// cluster, so it's only an error if none of them succeeded before the deadline.
+func distribute(ctx context.Context, sends map[string]func(ctx context.Context) error) error {
 
-	var aggResult = make(chan error, len(statusPublishFunctions))
-	var wg sync.WaitGroup
+	if len(sends) == 0 {
+		return errors.New("No publishers configured")
+	}
 
 	// Reserve 250ms so publish modules return before the deadline
 	deadline, ok := ctx.Deadline()
 	if !ok {
 		return errors.New("Invalid context provided to publish function")
 	}
-	timeLeft := deadline.Sub(time.Now().Add(250 * time.Millisecond))
-	childCtx, cancel := context.WithTimeout(ctx, timeLeft)
+	childCtx, cancel := context.WithDeadline(ctx, deadline.Add(-250*time.Millisecond))
 	defer cancel()
 
 	// Call each publish function in parallel and return the results to a buffered channel.
-	for _, f := range statusPublishFunctions {
-		currentF := f
-		wg.Add(1)
-		go func(ctx context.Context, status check.Status) {
-			// Reserve 250ms so this function can aggregate results and return before the deadline
-			aggResult <- currentF(ctx, status)
-			wg.Done()
-		}(childCtx, status)
+	var results = make(chan error, len(sends))
+	for name, send := range sends {
+		go func(name string, send func(ctx context.Context) error) {
+			err := send(childCtx)
+			if err != nil {
+				log.WithError(err).WithField("publisher", name).Warn("Received publish function error")
+			}
+			results <- err
+		}(name, send)
 	}
 
 	// Wait until either context expires or all routines return
-	routinesDone := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(routinesDone)
-	}()
-	select {
-	case <-routinesDone:
-	case <-ctx.Done():
-		if len(heartbeatPublishFunctions) == 0 {
-			return errors.New("No publish functions succeeded before deadline expired")
+	var succeeded, failed int
+wait:
+	for succeeded+failed < len(sends) {
+		select {
+		case err := <-results:
+			if err != nil {
+				failed++
+				continue
+			}
+			succeeded++
+		case <-ctx.Done():
+			log.Warn("Not all publish functions responded before deadline expired")
+			break wait
 		}
-		// Some publish functions timed out. Should this be an error? Currently is not.
-		log.Warn("Not all publish functions responded before deadline expired")
 	}
-
-	// Declare a slice with the underlying array the size of our total number of results. This lets us count the number
-	// of non-nil responses easily
-	var es = make([]error, 0, len(heartbeatPublishFunctions))
-	for i := 0; i < len(heartbeatPublishFunctions); i++ {
-		if e := <-aggResult; e != nil {
-			log.WithError(e).Warn("Received publish function error")
-			es = append(es, e)
-		}
+	if succeeded == 0 {
+		return errors.New("No publish functions succeeded")
 	}
-	// Some functions failed. Should this be an error? Currently is.
-	if len(es) > 0 {
-		return errors.New("Some publish functions failed")
+	if failed > 0 {
+		log.WithFields(logrus.Fields{
+			"succeeded": succeeded,
+			"failed":    failed,
+		}).Info("Published through some publishers only")
 	}
 	return nil
 }
@@ -0,0 +1,82 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/url/check"
+	"testing"
+	"time"
+)
+
+func TestDistribute(t *testing.T) {
+	log = logger.New("publish", logrus.FatalLevel)
+	defer stubSeal()()
+	ok := Publisher{Heartbeat: func(ctx context.Context, beat heartbeat.Beat, msg []byte) error { return nil }}
+	failing := Publisher{Heartbeat: func(ctx context.Context, beat heartbeat.Beat, msg []byte) error {
+		return errors.New("broker unavailable")
+	}}
+	hanging := Publisher{Heartbeat: func(ctx context.Context, beat heartbeat.Beat, msg []byte) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tables := []struct {
+		description string
+		publishers  map[string]Publisher
+		ok          bool
+	}{
+		{"all succeed", map[string]Publisher{"amqp": ok, "amqp:backup": ok}, true},
+		{"primary down", map[string]Publisher{"amqp": failing, "amqp:backup": ok}, true},
+		{"primary hangs", map[string]Publisher{"amqp": hanging, "amqp:backup": ok}, true},
+		{"all down", map[string]Publisher{"amqp": failing, "amqp:backup": hanging}, false},
+		{"none configured", map[string]Publisher{}, false},
+	}
+	for _, table := range tables {
+		publishers = table.publishers
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := distributeHeartbeats(ctx, heartbeat.Beat{})
+		cancel()
+		if (err == nil) != table.ok {
+			t.Errorf("Error in distributeHeartbeats() for case %q, expected success %v, got %v", table.description,
+				table.ok, err)
+		}
+	}
+}
+
+// TestLegacyModule checks that a module using the deprecated registration functions still publishes once configured,
+// and that its functions don't count as a publisher when its configuration fails.
+func TestLegacyModule(t *testing.T) {
+	defer stubSeal()()
+	defer func() {
+		delete(configParseFunctions, "legacy")
+		delete(legacy, "legacy")
+	}()
+	var sent int
+	RegisterConfigFunction("legacy", func(config json.RawMessage, ll logrus.Level) error {
+		if string(config) != "{}" {
+			return errors.New("bad configuration")
+		}
+		return nil
+	})
+	RegisterHeartbeatPublishFunction("legacy", func(ctx context.Context, beat heartbeat.Beat) error {
+		sent++
+		return nil
+	})
+
+	hc, sc := make(chan heartbeat.Beat, 1), make(chan check.Status, 1)
+	if err := Initialise(json.RawMessage(`{"legacy": []}`), hc, sc, logrus.FatalLevel); err == nil {
+		t.Errorf("Error in Initialise(), expected an error when the only module failed to configure")
+	}
+	if err := Initialise(json.RawMessage(`{"legacy": {}}`), hc, sc, logrus.FatalLevel); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Publish(ctx, heartbeat.Beat{}); err != nil || sent != 1 {
+		t.Errorf("Error in Publish(), expected the legacy module to publish once, got %v sends and %v", sent, err)
+	}
+}
@@ -0,0 +1,22 @@
+package redis
+
+import (
+	"context"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/url/check"
+)
+
+// sendStatus is a thin wrapper around the server, sends the sealed status with a "status" type
+func (s *server) sendStatus(ctx context.Context, status check.Status, msg []byte) error {
+	return s.send(ctx, "status", msg)
+}
+
+// sendHeartbeat is a thin wrapper around the server, sends the sealed heartbeat with a "heartbeat" type
+func (s *server) sendHeartbeat(ctx context.Context, beat heartbeat.Beat, msg []byte) error {
+	return s.send(ctx, "heartbeat", msg)
+}
+
+// sendStatuses sends a batch of sealed statuses together.
+func (s *server) sendStatuses(ctx context.Context, statuses []check.Status, msgs [][]byte) error {
+	return s.send(ctx, "status", msgs...)
+}
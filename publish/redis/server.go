@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"github.com/alowde/dpoller/pkg/tlsconf"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// server contains all of the information required to connect to a Redis server.
+type server struct {
+	client       *redis.Client
+	URL          string         `json:"url"`            // e.g. redis://:password@host:6379/0
+	Mode         string         `json:"mode"`           // "pubsub" (default) or "streams"
+	KeyPrefix    string         `json:"key-prefix"`     // messages are sent to <prefix>:status and <prefix>:heartbeat
+	StreamMaxLen int64          `json:"stream-max-len"` // approximate number of entries retained per stream
+	TLS          tlsconf.Config `json:"tls"`
+}
+
+func (s *server) validate() error {
+	if s.URL == "" {
+		return errors.New("missing url field")
+	}
+	switch s.Mode {
+	case "":
+		s.Mode = "pubsub"
+	case "pubsub", "streams":
+	default:
+		return errors.Errorf("unknown mode %q, expected pubsub or streams", s.Mode)
+	}
+	if s.KeyPrefix == "" {
+		s.KeyPrefix = "dpoller"
+	}
+	if s.StreamMaxLen <= 0 {
+		s.StreamMaxLen = 10000
+	}
+	return nil
+}
+
+// connect creates the Redis client and checks the server is reachable. The client maintains its own connection pool
+// and will reconnect as required.
+func (s *server) connect() error {
+	opts, err := redis.ParseURL(s.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid url")
+	}
+	if s.TLS.Enabled() {
+		if opts.TLSConfig, err = s.TLS.Build(); err != nil {
+			return errors.Wrap(err, "invalid TLS configuration")
+		}
+	}
+	s.client = redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return errors.Wrap(err, "could not reach Redis server")
+	}
+	return nil
+}
+
+// send publishes messages to the channel or stream for their type, pipelining them in a single round trip.
+func (s *server) send(ctx context.Context, msgType string, msgs ...[]byte) error {
+	key := s.KeyPrefix + ":" + msgType
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, msg := range msgs {
+			if s.Mode == "streams" {
+				pipe.XAdd(ctx, &redis.XAddArgs{
+					Stream: key,
+					MaxLen: s.StreamMaxLen,
+					Approx: true,
+					Values: map[string]interface{}{"data": msg},
+				})
+			} else {
+				pipe.Publish(ctx, key, msg)
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "while publishing to Redis")
+}
@@ -0,0 +1,66 @@
+package publish_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/alowde/dpoller/envelope"
+	"github.com/alowde/dpoller/heartbeat"
+	"github.com/alowde/dpoller/publish"
+	"github.com/alowde/dpoller/url/check"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSealOnce publishes through two redundant instances of a transport and checks a node receiving both copies
+// delivers the message only once.
+func TestSealOnce(t *testing.T) {
+	raw := json.RawMessage(`{}`)
+	if err := envelope.Initialise(&raw, logrus.FatalLevel); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+
+	var mu sync.Mutex
+	var received [][]byte
+	publish.RegisterPublisherFunction("redundant", func(json.RawMessage, logrus.Level) (publish.Publisher, error) {
+		return publish.Publisher{
+			Status: func(ctx context.Context, status check.Status, msg []byte) error {
+				mu.Lock()
+				received = append(received, msg)
+				mu.Unlock()
+				return nil
+			},
+		}, nil
+	})
+	config := json.RawMessage(`{"redundant": {}, "redundant:backup": {}}`)
+	sc := make(chan check.Status, 10)
+	if err := publish.Initialise(config, make(chan heartbeat.Beat, 10), sc, logrus.FatalLevel); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := publish.Publish(ctx, check.Status{Timestamp: int(time.Now().Unix())}); err != nil {
+		t.Fatalf("Received error %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("Error in Publish(), expected a copy through each publisher, got %v", len(received))
+	}
+	var delivered int
+	for _, msg := range received {
+		_, err := envelope.Open(msg)
+		switch {
+		case err == nil:
+			delivered++
+		case !envelope.Duplicate(err):
+			t.Errorf("Error in Open(), unexpected rejection %v", err)
+		}
+	}
+	if delivered != 1 {
+		t.Errorf("Error in Publish(), receiver delivered %v copies of one status, expected 1", delivered)
+	}
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"github.com/alowde/dpoller/alert"
+	"github.com/alowde/dpoller/api"
 	"github.com/alowde/dpoller/config"
 	"github.com/alowde/dpoller/consensus"
 	"github.com/alowde/dpoller/coordinate"
+	"github.com/alowde/dpoller/envelope"
 	"github.com/alowde/dpoller/heartbeat"
 	"github.com/alowde/dpoller/listen"
+	"github.com/alowde/dpoller/members"
+	"github.com/alowde/dpoller/node"
 	"github.com/alowde/dpoller/pkg/flags"
 	"github.com/alowde/dpoller/publish"
 	"github.com/alowde/dpoller/url"
@@ -35,9 +39,9 @@ func (r *routine) check() error {
 			// update each time.
 			r.lastCheckin = status.Timestamp
 		default:
-			// Once we've received all status messages then check if we've received one in the last 120 seconds. If not
-			// raise an error as the routine is considered to have timed out
-			if time.Since(r.lastCheckin).Seconds() > 120 {
+			// Once we've received all status messages then check if we've received one within the routine timeout. If
+			// not raise an error as the routine is considered to have timed out
+			if time.Since(r.lastCheckin) > heartbeat.RoutineTimeout() {
 				log.Infof("Current time %v, timestamp %v", time.Now(), r.lastCheckin)
 				return heartbeat.NewTimeout()
 			}
@@ -71,19 +75,37 @@ func (r routines) start(conf *config.Skeleton) (err error) {
 	var hchan chan heartbeat.Beat
 	var schan chan check.Status
 
+	if err = node.Configure(conf.Node); err != nil {
+		err = errors.Wrap(err, "could not configure node")
+		return
+	}
+
+	// Every routine's timing depends on the cluster configuration
+	if err = heartbeat.Configure(conf.Cluster); err != nil {
+		err = errors.Wrap(err, "could not configure cluster timing")
+		return
+	}
+
+	// Message authentication must be configured before any messages are sent or received
+	if err = envelope.Initialise(conf.Security, flags.SecurityLog.Level); err != nil {
+		err = errors.Wrap(err, "could not initialise message authentication")
+		return
+	}
+
 	r["listen"].status, hchan, schan, err = listen.Initialise(*conf.Listen, flags.ListenLog.Level)
 	if err != nil {
 		err = errors.Wrap(err, "could not initialise listen functions")
 		return
 	}
 
-	r["coordinate"].status, err = coordinate.Initialise(hchan, flags.CoordLog.Level)
+	members.Initialise(flags.CoordLog.Level)
+	r["coordinate"].status, err = coordinate.Initialise(conf.Coordinate, hchan, flags.CoordLog.Level)
 	if err != nil {
 		err = errors.Wrap(err, "could not initialise coordinator routine")
 		return
 	}
 
-	r["consensus"].status, err = consensus.Initialise(schan, flags.ConsensusLog.Level)
+	r["consensus"].status, err = consensus.Initialise(conf.Consensus, schan, flags.ConsensusLog.Level)
 	if err != nil {
 		err = errors.Wrap(err, "could not initialise consensus monitoring routine")
 		return
@@ -109,6 +131,11 @@ func (r routines) start(conf *config.Skeleton) (err error) {
 		return
 	}
 
+	if err = api.Initialise(conf.API, flags.APILog.Level); err != nil {
+		err = errors.Wrap(err, "could not initialise API")
+		return
+	}
+
 	return
 }
 
@@ -3,12 +3,19 @@
 package check
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/alowde/dpoller/node"
 	"io"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -33,13 +40,128 @@ func logClose(c io.Closer) {
 // Check defines the configuration for a single URL to be checked together with its pass/fail conditions and alerting
 // information.
 type Check struct {
-	URL            string   `json:"url"`
-	Name           string   `json:"name"`
-	OkStatus       []int    `json:"ok-statuses"`
-	AlertThreshold int8     `json:"alert-below"`
-	AlertInterval  int      `json:"alert-interval"`
-	TestInterval   int      `json:"test-interval"`
-	Contacts       []string `json:"contacts"`
+	URL            string    `json:"url"`
+	Name           string    `json:"name"`
+	OkStatus       []int     `json:"ok-statuses"`
+	AlertThreshold int8      `json:"alert-below"`
+	AlertInterval  int       `json:"alert-interval"`
+	TestInterval   int       `json:"test-interval"`
+	Contacts       []string  `json:"contacts"`
+	Consensus      Consensus `json:"consensus"`
+	MinReporting   Quorum    `json:"min-reporting-nodes"` // nodes that must report before the result is trusted
+	SilentWindows  int       `json:"no-report-windows"`   // alert after this many consensus windows without a report
+}
+
+// Quorum is a minimum number of nodes, given either as a count or as a percentage of the live nodes, e.g. 3 or "50%".
+type Quorum struct {
+	Count   int
+	Percent int
+}
+
+// UnmarshalJSON accepts either a number or a percentage string.
+func (q *Quorum) UnmarshalJSON(b []byte) error {
+	var count int
+	if err := json.Unmarshal(b, &count); err == nil {
+		*q = Quorum{Count: count}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("quorum must be a number or a percentage")
+	}
+	p, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || !strings.HasSuffix(s, "%") || p < 0 || p > 100 {
+		return fmt.Errorf("invalid quorum percentage %q", s)
+	}
+	*q = Quorum{Percent: p}
+	return nil
+}
+
+// MarshalJSON writes the quorum in the form it was configured.
+func (q Quorum) MarshalJSON() ([]byte, error) {
+	if q.Percent > 0 {
+		return json.Marshal(fmt.Sprintf("%v%%", q.Percent))
+	}
+	return json.Marshal(q.Count)
+}
+
+// Required returns the number of reporting nodes needed given the number of live nodes. At least one is always needed.
+func (q Quorum) Required(live int) int {
+	n := q.Count
+	if q.Percent > 0 {
+		n = (live*q.Percent + 99) / 100
+	}
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Consensus describes how results from different groups of nodes are weighed before alerting. By default every node
+// counts equally, so a large group of nodes in one place can outvote a smaller group elsewhere. Grouping by a node
+// label instead requires failures to be seen from several places, e.g. "by: region, min-groups: 2" only alerts when
+// the check is failing from at least two regions. Nodes without the label aren't known to be anywhere in particular,
+// so they don't count towards min-groups unless count-unlabelled is set.
+type Consensus struct {
+	By              string          `json:"by"`               // node label to group results by, e.g. "region"
+	MinGroups       int             `json:"min-groups"`       // alert once this many groups are failing, defaults to 1
+	Thresholds      map[string]int8 `json:"thresholds"`       // alert-below for particular groups, defaults to the check's
+	CountUnlabelled bool            `json:"count-unlabelled"` // count nodes without the label as a group of their own
+}
+
+// Unlabelled is the group of nodes that don't have the label a check's consensus is grouped by.
+const Unlabelled = "unlabelled"
+
+// threshold returns the alert-below for a group.
+func (t Check) threshold(group string) int8 {
+	if th, ok := t.Consensus.Thresholds[group]; ok {
+		return th
+	}
+	return t.AlertThreshold
+}
+
+// FailingGroups returns the groups, in order, whose results are below their alert threshold.
+func (t Check) FailingGroups(r Result) (groups []string) {
+	for g, gr := range r.Breakdown {
+		if gr.PassPercent < t.threshold(g) {
+			groups = append(groups, g)
+		}
+	}
+	sort.Strings(groups)
+	return
+}
+
+// Failing reports whether a result should raise an alert under the check's consensus rules.
+func (t Check) Failing(r Result) bool {
+	if t.Consensus.By == "" {
+		return r.PassPercent < t.AlertThreshold
+	}
+	min := t.Consensus.MinGroups
+	if min < 1 {
+		min = 1
+	}
+	failing := 0
+	for _, g := range t.FailingGroups(r) {
+		if g != Unlabelled || t.Consensus.CountUnlabelled {
+			failing++
+		}
+	}
+	return failing >= min
+}
+
+// Hash returns a short digest of the fields that define the check's probe, allowing nodes to refer to a check by name
+// and still detect when they'd test it differently. Alerting and consensus settings only matter to the node evaluating
+// results, so they're left out and may differ between nodes.
+func (t Check) Hash() string {
+	probe := struct {
+		URL          string
+		Name         string
+		OkStatus     []int
+		TestInterval int
+	}{t.URL, t.Name, t.OkStatus, t.TestInterval}
+	b, _ := json.Marshal(probe) // strings and ints can't fail to marshal
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
 }
 
 // run runs a single URL test.
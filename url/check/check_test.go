@@ -2,6 +2,8 @@ package check
 
 import "testing"
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/alowde/dpoller/node"
 	"net"
 	"time"
@@ -11,16 +13,16 @@ var time1 int
 var time2 int
 
 var node1 = node.Node{
-	1000000000000000000,
-	net.IP{10, 0, 0, 1},
-	"test_node_1",
+	ID:   1000000000000000000,
+	EIP:  net.IP{10, 0, 0, 1},
+	Name: "test_node_1",
 }
 
 /*
 var node2 = node.Node{
-	2000000000000000000,
-	net.IP{10, 0, 0, 2},
-	"test_node_2",
+	ID:   2000000000000000000,
+	EIP:  net.IP{10, 0, 0, 2},
+	Name: "test_node_2",
 }
 */
 
@@ -118,3 +120,215 @@ func TestDedupe(t *testing.T) {
 		}
 	})
 }
+
+func TestHash(t *testing.T) {
+	c := check1
+	c.Consensus = Consensus{By: "region", MinGroups: 2}
+	c.MinReporting = Quorum{Percent: 50}
+	c.AlertThreshold = 10
+	if c.Hash() != check1.Hash() {
+		t.Errorf("Error in Hash(), expected alerting and consensus settings not to change the hash")
+	}
+	c.TestInterval++
+	if c.Hash() == check1.Hash() {
+		t.Errorf("Error in Hash(), expected a different test-interval to change the hash")
+	}
+}
+
+func TestConsensusByLabel(t *testing.T) {
+	// Five nodes in one region pass while two nodes in each of two other regions fail, as does an unlabelled node
+	var s Statuses
+	for i := 0; i < 9; i++ {
+		region, code := "eu", 200
+		if i >= 7 {
+			region, code = "ap", 500
+		} else if i >= 5 {
+			region, code = "us", 500
+		}
+		n := node.Node{ID: int64(i), Labels: map[string]string{"region": region}}
+		s = append(s, Status{Node: n, Url: check1, StatusCode: code})
+	}
+	s = append(s, Status{Node: node.Node{ID: 9}, Url: check1, StatusCode: 500})
+
+	r, err := s.CalculateResultBy("region")
+	if err != nil {
+		t.Fatalf("Error in CalculateResultBy(): %v", err)
+	}
+	if len(r.Breakdown) != 4 || r.Breakdown["eu"].Passed != 5 || r.Breakdown["us"].Failed != 2 ||
+		r.Breakdown[Unlabelled].Total != 1 {
+		t.Errorf("Error in CalculateResultBy(), unexpected breakdown %+v", r.Breakdown)
+	}
+
+	tables := []struct {
+		description string
+		check       Check
+		failing     bool
+	}{
+		{"overall pass percentage", Check{AlertThreshold: 40}, false},
+		{"any region failing", Check{AlertThreshold: 40, Consensus: Consensus{By: "region"}}, true},
+		{"two regions failing", Check{AlertThreshold: 40, Consensus: Consensus{By: "region", MinGroups: 2}}, true},
+		{"three regions failing", Check{AlertThreshold: 40, Consensus: Consensus{By: "region", MinGroups: 3}}, false},
+		{"counting unlabelled nodes", Check{AlertThreshold: 40, Consensus: Consensus{By: "region", MinGroups: 3,
+			CountUnlabelled: true}}, true},
+		{"per-region threshold", Check{AlertThreshold: 40, Consensus: Consensus{By: "region", MinGroups: 2,
+			Thresholds: map[string]int8{"us": 0}}}, false},
+	}
+	for _, table := range tables {
+		if f := table.check.Failing(r); f != table.failing {
+			t.Errorf("Error in Failing() for case %q, expected %v, got %v (failing groups %v)", table.description,
+				table.failing, f, table.check.FailingGroups(r))
+		}
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	for _, table := range []struct {
+		config   string
+		live     int
+		required int
+	}{
+		{`0`, 10, 1},
+		{`4`, 2, 4},
+		{`"50%"`, 5, 3},
+		{`"50%"`, 0, 1},
+	} {
+		var q Quorum
+		if err := json.Unmarshal([]byte(table.config), &q); err != nil {
+			t.Errorf("Error in UnmarshalJSON() for %v: %v", table.config, err)
+			continue
+		}
+		if r := q.Required(table.live); r != table.required {
+			t.Errorf("Error in Required() for %v of %v, expected %v, got %v", table.config, table.live, table.required, r)
+		}
+	}
+	var q Quorum
+	if err := json.Unmarshal([]byte(`"150%"`), &q); err == nil {
+		t.Errorf("Error in UnmarshalJSON(), expected 150%% to be rejected")
+	}
+}
+
+func TestTrust(t *testing.T) {
+	defer ForgetTrust(func(string) bool { return false })
+
+	// Four nodes pass while a flaky fifth keeps failing
+	var s Statuses
+	for i := int64(1); i <= 5; i++ {
+		code := 200
+		if i == 5 {
+			code = 500
+		}
+		s = append(s, Status{Node: node.Node{ID: i, Name: fmt.Sprintf("node%v", i)}, Url: check1, StatusCode: code})
+	}
+	if r, _ := s.CalculateResult(); r.PassPercent != 80 || len(r.LowTrustNodes) != 0 {
+		t.Errorf("Error in CalculateResult(), expected 80%% with every node trusted, got %v%% and %v", r.PassPercent,
+			r.LowTrustNodes)
+	}
+	for i := 0; i < 30; i++ {
+		check1.UpdateTrust(s, s)
+	}
+	if Trust("node1") != 1 || Trust("node5") >= LowTrust || Trust("node5") < MinTrust {
+		t.Errorf("Error in UpdateTrust(), expected only the flaky node to lose trust, got %v", TrustScores())
+	}
+	r, _ := s.CalculateResult()
+	if r.PassPercent < 90 || len(r.LowTrustNodes) != 1 || r.LowTrustNodes[0] != "node5" {
+		t.Errorf("Error in CalculateResult(), expected the flaky node to count less, got %v%% and %v", r.PassPercent,
+			r.LowTrustNodes)
+	}
+	strict := Check{AlertThreshold: 100}
+	if !strict.Failing(r) || !strict.DrivenByLowTrust(s) {
+		t.Errorf("Error in DrivenByLowTrust(), expected the failure to be blamed on the flaky node")
+	}
+	if lenient := (Check{AlertThreshold: 50}); lenient.DrivenByLowTrust(s[:4]) {
+		t.Errorf("Error in DrivenByLowTrust(), expected no blame without low-trust nodes")
+	}
+
+	// A tie says nothing about who's right
+	check1.UpdateTrust(s[3:], s[3:])
+	if Trust("node4") != 1 {
+		t.Errorf("Error in UpdateTrust(), expected a tie to leave scores alone, got %v", Trust("node4"))
+	}
+
+	// Scores are kept by name, so a restarted node with a new ID keeps its score
+	restarted := s[4]
+	restarted.Node.ID = 50
+	pair := Statuses{s[0], restarted}
+	if r, _ := pair.CalculateResult(); len(r.LowTrustNodes) != 1 {
+		t.Errorf("Error in CalculateResult(), expected a restarted node to keep its low trust")
+	}
+
+	ForgetTrust(func(name string) bool { return name != "node5" })
+	if Trust("node5") != 1 {
+		t.Errorf("Error in ForgetTrust(), expected a forgotten node to be trusted again, got %v", Trust("node5"))
+	}
+}
+
+func TestTrustByLabel(t *testing.T) {
+	defer ForgetTrust(func(string) bool { return false })
+
+	// Two nodes in one region see an outage that the three nodes elsewhere don't
+	var s Statuses
+	for i := int64(1); i <= 5; i++ {
+		region, code := "eu", 200
+		if i > 3 {
+			region, code = "us", 500
+		}
+		n := node.Node{ID: i, Name: fmt.Sprintf("node%v", i), Labels: map[string]string{"region": region}}
+		s = append(s, Status{Node: n, Url: check1, StatusCode: code})
+	}
+	regional := Check{OkStatus: check1.OkStatus, Consensus: Consensus{By: "region"}}
+	for i := 0; i < 30; i++ {
+		regional.UpdateTrust(s, s)
+	}
+	if scores := TrustScores(); len(scores) != 5 || Trust("node4") != 1 {
+		t.Errorf("Error in UpdateTrust(), expected nodes to agree within their region, got %v", scores)
+	}
+	for i := 0; i < 30; i++ {
+		check1.UpdateTrust(s, s)
+	}
+	if Trust("node4") >= LowTrust {
+		t.Errorf("Error in UpdateTrust(), expected the cluster-wide majority to outvote the region without grouping")
+	}
+}
+
+func TestWeights(t *testing.T) {
+	defer SetWeights(Weights{})
+
+	if err := SetWeights(Weights{Nodes: map[string]float64{"a": 0}}); err == nil {
+		t.Errorf("Error in SetWeights(), expected a zero weight to be rejected")
+	}
+	if err := SetWeights(Weights{
+		Nodes:  map[string]float64{"heavy": 3},
+		Labels: map[string]map[string]float64{"provider": {"cheap": 0.5}, "region": {"eu": 2}},
+	}); err != nil {
+		t.Fatalf("Error in SetWeights(): %v", err)
+	}
+	tables := []struct {
+		description string
+		node        node.Node
+		weight      float64
+	}{
+		{"unweighted", node.Node{Name: "plain"}, 1},
+		{"by name", node.Node{Name: "heavy", Labels: map[string]string{"region": "eu"}}, 3},
+		{"by label", node.Node{Name: "light", Labels: map[string]string{"provider": "cheap"}}, 0.5},
+		{"by several labels", node.Node{Name: "both", Labels: map[string]string{"provider": "cheap", "region": "eu"}}, 1},
+	}
+	for _, table := range tables {
+		if w := weightOf(table.node); w != table.weight {
+			t.Errorf("Error in weightOf() for case %q, expected %v, got %v", table.description, table.weight, w)
+		}
+	}
+
+	// Configured weights count alongside trust
+	var s Statuses
+	for i, name := range []string{"a", "b", "c", "heavy"} {
+		code := 200
+		if name == "heavy" {
+			code = 500
+		}
+		s = append(s, Status{Node: node.Node{ID: int64(i), Name: name}, Url: check1, StatusCode: code})
+	}
+	if r, _ := s.CalculateResult(); r.PassPercent != 50 {
+		t.Errorf("Error in CalculateResult(), expected a node of weight 3 to balance three others, got %v%%",
+			r.PassPercent)
+	}
+}
@@ -17,6 +17,11 @@ type Status struct {
 	Timestamp  int    // timestamp at which this status was recorded
 }
 
+// weight returns how much the status counts towards the pass percentage.
+func (s *Status) weight() float64 {
+	return weightOf(s.Node) * Trust(s.Node.Name)
+}
+
 func (s *Status) failed() bool {
 	for _, u := range s.Url.OkStatus {
 		if s.StatusCode == u {
@@ -36,9 +41,14 @@ type Result struct {
 	Failed          int   // number of checks that Failed
 	Passed          int   // number of checks that Passed
 	Total           int   // total number of checks
-	PassPercent     int8  // pass percentage, rounded up to whole number
+	PassPercent     int8  // pass percentage weighted by each node's weight and trust, rounded down to whole number
 	FailNodeIPs     []net.IP
 	FailNodeNames   []string
+	LowTrustNodes   []string          // names of failing nodes whose trust is below LowTrust
+	LowTrustDriven  bool              // the check only fails because of low-trust nodes, see DrivenByLowTrust
+	Epoch           uint64            // Coordinator lease epoch the result was alerted under, later epochs supersede earlier ones
+	By              string            // node label the Breakdown is grouped by, if any
+	Breakdown       map[string]Result // results for each value of the label, see Consensus
 }
 
 // Dedupe returns a Statuses containing only the most recent node-url result tuples.
@@ -75,20 +85,28 @@ func (s *Statuses) PerCheckName() (r map[string]Statuses) {
 	return r
 }
 
-// CalculateResult produces a single Result from Statuses
+// CalculateResult produces a single Result from Statuses. Each status counts towards the pass percentage in proportion
+// to its node's weight and trust, so a single unreliable node can't fail a check that every other node passes.
 func (s *Statuses) CalculateResult() (r Result, e error) {
 	if len(*s) < 1 {
 		return Result{}, errors.New("empty statuses array")
 	}
 	var failed Statuses
+	var passWeight, totalWeight float64
 	r.StatusCodes = make([]int, len(*s))
 	for i, v := range *s {
 		r.AverageResponse = r.AverageResponse + v.Rtime
 		r.StatusCodes[i] = v.StatusCode
+		totalWeight += v.weight()
 		if v.failed() {
 			failed = append(failed, v)
 			r.FailNodeIPs = append(r.FailNodeIPs, v.Node.EIP)
 			r.FailNodeNames = append(r.FailNodeNames, v.Node.Name)
+			if Trust(v.Node.Name) < LowTrust {
+				r.LowTrustNodes = append(r.LowTrustNodes, v.Node.Name)
+			}
+		} else {
+			passWeight += v.weight()
 		}
 	}
 	r.AverageResponse = r.AverageResponse / len(*s)
@@ -96,11 +114,39 @@ func (s *Statuses) CalculateResult() (r Result, e error) {
 	r.Failed = len(failed)
 	r.Passed = r.Total - r.Failed
 	r.StatusCodes = uniqInt(r.StatusCodes)
-	r.PassPercent = int8((float64(r.Passed) / float64(r.Total)) * float64(100))
+	r.PassPercent = int8((passWeight / totalWeight) * float64(100))
+
+	return r, nil
+}
 
+// CalculateResultBy produces a single Result from Statuses, broken down by the value of a node label. Nodes without
+// the label are grouped as Unlabelled. No breakdown is produced if the label is empty.
+func (s *Statuses) CalculateResultBy(label string) (r Result, e error) {
+	if r, e = s.CalculateResult(); e != nil || label == "" {
+		return
+	}
+	groups := s.groupBy(label)
+	r.By = label
+	r.Breakdown = make(map[string]Result, len(groups))
+	for g, statuses := range groups {
+		r.Breakdown[g], _ = statuses.CalculateResult() // groups are never empty
+	}
 	return r, nil
 }
 
+// groupBy splits the statuses by the value of a node label, grouping nodes without the label as Unlabelled.
+func (s Statuses) groupBy(label string) map[string]Statuses {
+	groups := make(map[string]Statuses)
+	for _, v := range s {
+		g, ok := v.Node.Labels[label]
+		if !ok || g == "" {
+			g = Unlabelled
+		}
+		groups[g] = append(groups[g], v)
+	}
+	return groups
+}
+
 // just for fun. Pays the sort price of O(n*log(n)) calls to swap and less, then one allocation per duplicate entry
 // I'm assuming this is cheaper than just allocating once for each non-duplicate entry. Need to benchmark
 func uniqInt(in sort.IntSlice) (out []int) {
@@ -0,0 +1,116 @@
+package check
+
+import "sync"
+
+// Trust scores reflect how often each node has agreed with the majority of nodes reporting on the same check. A node
+// on a flaky network that keeps reporting failures nobody else sees loses trust, and its results count for less in
+// the pass percentage. Every node starts fully trusted, and a node that starts agreeing again slowly regains trust.
+// Scores are kept by node name, which unlike the node's ID survives a restart, so node names should be unique. Like
+// weights, they rely on each node reporting its own name honestly.
+const (
+	// LowTrust is the score below which a node's results are considered unreliable.
+	LowTrust = 0.5
+	// MinTrust is the lowest score a node can fall to, so it never loses its say entirely and can recover.
+	MinTrust = 0.1
+	// trustRate is how much a single result moves a node's score, so roughly the last 1/trustRate results count.
+	trustRate = 0.05
+)
+
+var trust = struct {
+	sync.Mutex
+	scores map[string]float64
+}{scores: make(map[string]float64)}
+
+// Trust returns the trust score of the named node, between MinTrust and 1.
+func Trust(name string) float64 {
+	trust.Lock()
+	defer trust.Unlock()
+	if t, ok := trust.scores[name]; ok {
+		return t
+	}
+	return 1
+}
+
+// TrustScores returns the trust score of every node that's been scored.
+func TrustScores() map[string]float64 {
+	trust.Lock()
+	defer trust.Unlock()
+	scores := make(map[string]float64, len(trust.scores))
+	for name, t := range trust.scores {
+		scores[name] = t
+	}
+	return scores
+}
+
+// ForgetTrust drops the scores of nodes for which keep returns false, e.g. nodes that have left the cluster.
+func ForgetTrust(keep func(name string) bool) {
+	trust.Lock()
+	defer trust.Unlock()
+	for name := range trust.scores {
+		if !keep(name) {
+			delete(trust.scores, name)
+		}
+	}
+}
+
+// UpdateTrust scores the nodes that reported the fresh statuses by whether they agreed with the majority of all the
+// statuses for the check. Each status should only be scored once. When the check's consensus is grouped by a label,
+// nodes are only compared with others in the same group, so the nodes in a region that's genuinely failing don't lose
+// trust for disagreeing with the rest of the cluster.
+func (t Check) UpdateTrust(all, fresh Statuses) {
+	if t.Consensus.By == "" {
+		updateTrust(all, fresh)
+		return
+	}
+	groups := all.groupBy(t.Consensus.By)
+	for g, f := range fresh.groupBy(t.Consensus.By) {
+		updateTrust(groups[g], f)
+	}
+}
+
+// updateTrust scores the fresh statuses against the majority of all the statuses. The majority is a simple count so a
+// node's score never depends on the scores of the nodes it's compared to, and nothing is scored when the vote is tied.
+func updateTrust(all, fresh Statuses) {
+	var failed int
+	for _, v := range all {
+		if v.failed() {
+			failed++
+		}
+	}
+	if len(fresh) == 0 || failed*2 == len(all) {
+		return
+	}
+	majorityFailed := failed*2 > len(all)
+
+	trust.Lock()
+	defer trust.Unlock()
+	for _, v := range fresh {
+		t, ok := trust.scores[v.Node.Name]
+		if !ok {
+			t = 1
+		}
+		agreed := 0.0
+		if v.failed() == majorityFailed {
+			agreed = 1
+		}
+		if t += trustRate * (agreed - t); t < MinTrust {
+			t = MinTrust
+		}
+		trust.scores[v.Node.Name] = t
+	}
+}
+
+// DrivenByLowTrust reports whether a failing check would pass if only the results from trusted nodes were counted.
+func (t Check) DrivenByLowTrust(s Statuses) bool {
+	var trusted Statuses
+	for _, v := range s {
+		if Trust(v.Node.Name) >= LowTrust {
+			trusted = append(trusted, v)
+		}
+	}
+	if len(trusted) == len(s) {
+		return false
+	}
+	r, err := trusted.CalculateResultBy(t.Consensus.By)
+	return err != nil || !t.Failing(r)
+}
@@ -0,0 +1,57 @@
+package check
+
+import (
+	"github.com/alowde/dpoller/node"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// Weights sets how much particular nodes' results count in consensus relative to other nodes, which otherwise count
+// once. A node listed by name takes that weight, otherwise the weights of the labels it matches are multiplied
+// together. Names and labels are taken from the reporting node's own statuses, which authentication doesn't tie to the
+// sender, so weights guard against an unreliable location rather than a node that misrepresents itself.
+type Weights struct {
+	Nodes  map[string]float64            `json:"nodes"`  // by node name
+	Labels map[string]map[string]float64 `json:"labels"` // by label then value, e.g. {"provider": {"aws": 0.5}}
+}
+
+var weights = struct {
+	sync.Mutex
+	Weights
+}{}
+
+// SetWeights replaces the configured weights.
+func SetWeights(w Weights) error {
+	for _, v := range w.Nodes {
+		if v <= 0 {
+			return errors.New("node weights must be positive")
+		}
+	}
+	for _, values := range w.Labels {
+		for _, v := range values {
+			if v <= 0 {
+				return errors.New("label weights must be positive")
+			}
+		}
+	}
+	weights.Lock()
+	defer weights.Unlock()
+	weights.Weights = w
+	return nil
+}
+
+// weightOf returns the configured weight of a node.
+func weightOf(n node.Node) float64 {
+	weights.Lock()
+	defer weights.Unlock()
+	if w, ok := weights.Nodes[n.Name]; ok {
+		return w
+	}
+	w := 1.0
+	for label, values := range weights.Labels {
+		if v, ok := values[n.Labels[label]]; ok {
+			w *= v
+		}
+	}
+	return w
+}
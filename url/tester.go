@@ -1,12 +1,12 @@
 package url
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/alowde/dpoller/heartbeat"
 	"github.com/alowde/dpoller/logger"
+	"github.com/alowde/dpoller/node"
 	"github.com/alowde/dpoller/publish"
 	"github.com/alowde/dpoller/url/check"
 	"github.com/pkg/errors"
@@ -44,10 +44,23 @@ func Initialise(config []byte, ll logrus.Level) (routineStatus chan error, err e
 		}
 	}
 	routineStatus = make(chan error, 300)
+	// Checks are still needed to evaluate statuses from other nodes, even if this node doesn't run them
+	if !node.SelfRole.Probes() {
+		log.WithField("role", node.SelfRole).Info("Not running checks in this node role")
+		go idle(routineStatus)
+		return routineStatus, nil
+	}
 	go runTests(routineStatus)
 	return routineStatus, nil
 }
 
+// idle reports the routine healthy without running any checks.
+func idle(routineStatus chan error) {
+	for range time.Tick(heartbeat.RoutineInterval()) {
+		routineStatus <- heartbeat.NewRoutineNormal().SetOrigin("idle")
+	}
+}
+
 func runTests(routineStatus chan error) {
 	var runList []checkRun
 
@@ -55,16 +68,8 @@ func runTests(routineStatus chan error) {
 	for i := 0; i < 5; i++ {
 		minWait := time.After(12 * time.Second)
 		for j := 0 + i; j < len(Checks); j += 5 {
-			tr := checkRun{
-				Check: check.Check{
-					URL:           Checks[j].URL,
-					Name:          Checks[j].Name,
-					OkStatus:      Checks[j].OkStatus,
-					AlertInterval: Checks[j].AlertInterval,
-					TestInterval:  Checks[j].TestInterval,
-					Contacts:      Checks[j].Contacts,
-				},
-			}
+			// Statuses carry the whole check so its hash matches the configuration other nodes hold
+			tr := checkRun{Check: Checks[j]}
 			tr.run()
 			runList = append(runList, tr)
 		}
@@ -79,17 +84,13 @@ func runTests(routineStatus chan error) {
 		for k, tr := range runList {
 			select {
 			case result, ok := <-tr.result:
-				// TODO: Implement async and batch publish methods and use one of those
 				log.WithField("url", tr.URL).
 					Debug("Got a result")
 				if ok {
-					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-					if err := publish.Publish(ctx, result); err != nil {
-						// TODO: unwrap error and handle timeouts differently from other errors
+					if err := publish.PublishAsync(result); err != nil {
 						log.WithField("error", err).Warn("failed to publish test result")
 					}
-					cancel()
-					log.WithField("url", tr.URL).Debug("Published a result")
+					log.WithField("url", tr.URL).Debug("Queued a result")
 					if time.Since(tr.lastRan) > (time.Duration(tr.TestInterval) * time.Second) {
 						runList[k].run()
 					}